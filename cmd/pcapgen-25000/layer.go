@@ -0,0 +1,42 @@
+package main
+
+import (
+	"git.cyberfire.ninja/devs/pcapgen/pkg/layer"
+)
+
+// Netarch describes the protocol, for decoding with gopacket.
+//
+// The session is 16 bits little-endian for both header kinds:
+// in the original header, the high byte is the zero pad.
+var Netarch = &layer.Protocol{
+	Name: "netarch-25000",
+	Header: []layer.Field{
+		{Name: "opcode", Size: 1},
+		{Name: "pad", Size: 1},
+		{Name: "session", Size: 2},
+	},
+	Opcode: "opcode",
+	Messages: []layer.Message{
+		{Opcode: OpAck, Name: "ack"},
+		{Opcode: OpXferBegin, Name: "xfer-begin", Fields: []layer.Field{
+			{Name: "size", Size: 4},
+			{Name: "name-length", Size: 1},
+			{Name: "name", Length: "name-length"},
+		}},
+		{Opcode: OpXfer, Name: "xfer", Fields: []layer.Field{
+			{Name: "length", Size: 2},
+			{Name: "data", Length: "length"},
+		}},
+		{Opcode: OpXferBeginExt, Name: "xfer-begin-ext", Fields: []layer.Field{
+			{Name: "size", Size: 8},
+			{Name: "name-length", Size: 2},
+			{Name: "name", Length: "name-length"},
+		}},
+		{Opcode: OpXferExt, Name: "xfer-ext", Fields: []layer.Field{
+			{Name: "length", Size: 2},
+			{Name: "data", Length: "length"},
+		}},
+	},
+	LittleEndian: true,
+	Key:          key,
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/layer"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func netarchLayerType(t *testing.T) gopacket.LayerType {
+	lt, err := Netarch.Register(25000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lt
+}
+
+// Packets built by the layer match the ones the generator sends
+func TestLayerSerialize(t *testing.T) {
+	netarchLayerType(t)
+	buf := new(bytes.Buffer)
+	cli, _ := pcapwriter.NewICMPv4Writers(buf, 11, buf, 55)
+
+	begin := Netarch.New(OpXferBeginExt)
+	begin.Values["session"] = 0x1234
+	begin.Values["size"] = 0x0102030405
+	begin.Bytes["name"] = []byte("moo")
+	if _, err := cli.WritePacket(&cli.ICMPv4, begin); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Protocol{Extended: true}.XferBeginPacket(0x1234, 0x0102030405, "moo")
+	packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	if got := packet.Layer(layers.LayerTypeICMPv4).LayerPayload(); !bytes.Equal(got, want) {
+		t.Errorf("wrong packet: %x", got)
+	}
+}
+
+// The generator's frames decode into their fields
+func TestLayerDecode(t *testing.T) {
+	lt := netarchLayerType(t)
+	f, err := os.Open("testdata/default.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var data []byte
+	for {
+		frame, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+		icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+		msg := gopacket.NewPacket(icmp.Payload, lt, gopacket.Default)
+		l, ok := msg.Layer(lt).(*layer.Layer)
+		if !ok || l.Message() == nil {
+			// The handshake is junk
+			continue
+		}
+		switch l.Message().Name {
+		case "xfer-begin":
+			names = append(names, string(l.Bytes["name"]))
+		case "xfer":
+			if l.Values["session"] == 0 {
+				data = append(data, l.Bytes["data"]...)
+			}
+		}
+	}
+
+	if strings.Join(names, " ") != "testdata/alpha.txt testdata/bravo.bin" {
+		t.Error("wrong file names:", names)
+	}
+	alpha, _ := os.ReadFile("testdata/alpha.txt")
+	if !bytes.Equal(data, alpha) {
+		t.Errorf("wrong data for session 0: %d bytes", len(data))
+	}
+}
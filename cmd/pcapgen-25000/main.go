@@ -1,112 +1,172 @@
 package main
 
 import (
-	"crypto/rand"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
-	"sync"
 	"time"
 
+	"git.cyberfire.ninja/devs/pcapgen/pkg/answerkey"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/layer"
 	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
 )
 
-func junk(n int) []byte {
+func junk(rng *rand.Rand, n int) []byte {
 	buf := make([]byte, n)
-	if _, err := rand.Read(buf); err != nil {
+	if _, err := rng.Read(buf); err != nil {
 		log.Fatal(err)
 	}
 	return buf
 }
 
-func sink(r io.Reader, wg *sync.WaitGroup) {
-	defer wg.Done()
-	buf := make([]byte, 4096)
-	for {
-		if _, err := r.Read(buf); (err == io.EOF) || (err == io.ErrClosedPipe) {
-			return
-		} else if err != nil {
-			log.Println("Read error:", err)
-		}
-	}
-}
-
 func usage() {
 	out := flag.CommandLine.Output()
 	fmt.Fprintf(out, "Usage: %s FILE [FILE...]\n", os.Args[0])
+	fmt.Fprintf(out, "       %s -dissector > netarch-25000.lua\n", os.Args[0])
 	flag.PrintDefaults()
 	fmt.Fprintln(out, "")
 	fmt.Fprintln(out, "Runs a netarch 25000 session, transferring all listed files, multiplexed.")
+	fmt.Fprintln(out, "With -dissector, writes a Wireshark Lua dissector for the protocol instead.")
 }
 
-func converse(cli, srv io.Writer, filenames []string) {
-	files := make([]io.ReadCloser, len(flag.Args()))
-
-	// Pretend there's some sort of undecodable initialization handshake
-	cli.Write(junk(0x40))
-	srv.Write(junk(0x20))
-	cli.Write(junk(12))
+// prepare checks that every file can be sent with proto,
+// before anything is written.
+func prepare(proto Protocol, filenames []string) ([]*transfer, error) {
+	if len(filenames) > proto.MaxSessions() {
+		return nil, fmt.Errorf("%w: %d files, limit is %d", ErrTooManySessions, len(filenames), proto.MaxSessions())
+	}
 
-	// Server: request files
+	xfers := make([]*transfer, len(filenames))
 	for i, name := range filenames {
-		f, err := os.Open(name)
+		fi, err := os.Stat(name)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		if err := proto.Check(i, fi.Size(), name); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		xfers[i] = &transfer{
+			session:   i,
+			name:      name,
+			remaining: fi.Size(),
 		}
-		fi, err := f.Stat()
+	}
+	return xfers, nil
+}
+
+// addFile records x in the answer key
+func addFile(conv *answerkey.Conversation, x *transfer) error {
+	f, err := os.Open(x.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return conv.AddFile(x.session, x.name, f)
+}
+
+func converse(cli, srv io.Writer, proto Protocol, xfers []*transfer, chunker Chunker, scheduler Scheduler, rng *rand.Rand) {
+	// Pretend there's some sort of undecodable initialization handshake
+	cli.Write(junk(rng, 0x40))
+	srv.Write(junk(rng, 0x20))
+	cli.Write(junk(rng, 12))
+
+	// Server: request files
+	for _, x := range xfers {
+		buf, err := proto.XferBeginPacket(x.session, x.remaining, x.name)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		srv.Write(XferBeginPacket(uint8(i), uint32(fi.Size()), name))
+		srv.Write(buf)
 		cli.Write(AckPacket())
-		files[i] = f
 	}
 
-	filesLeft := len(files)
+	filesLeft := len(xfers)
 	for filesLeft > 0 {
-		filesLeft = 0
-		for i, f := range files {
-			buf, err := XferPacket(uint8(i), f)
-			if err == io.EOF {
-				continue
-			} else if err != nil {
-				log.Fatal(err)
-			}
-			cli.Write(buf)
-			srv.Write(AckPacket())
-			filesLeft += 1
+		x := xfers[scheduler.Next(xfers)]
+		buf, err := proto.XferPacket(x.session, x, chunker.Size(x))
+		if err == io.EOF {
+			x.done = true
+			filesLeft -= 1
+			continue
+		} else if err != nil {
+			log.Fatal(err)
 		}
+		cli.Write(buf)
+		srv.Write(AckPacket())
+		x.chunks += 1
 	}
 }
 
 func main() {
 	flag.Usage = usage
+	chunkPolicy := flag.String("chunk", "fixed", "Chunk size policy: fixed, random, shrink")
+	chunkMin := flag.Int("chunk-min", 100, "Smallest chunk size, for random and shrink policies")
+	chunkMax := flag.Int("chunk-max", 500, "Largest chunk size; fixed policy always uses this")
+	schedPolicy := flag.String("schedule", "rr", "Scheduling policy: rr, sequential, weighted, bursty")
+	extended := flag.Bool("extended", false, "Use extended headers: 16-bit sessions, long names, 64-bit sizes")
+	keyFile := flag.String("key", "", "Write a JSON answer key to this file")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for handshake, chunking, scheduling, and jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	dissector := flag.Bool("dissector", false, "Write a Wireshark Lua dissector instead of a capture")
 	flag.Parse()
+	if *dissector {
+		if err := Netarch.WriteDissector(os.Stdout, layer.Dissector{ICMP: true}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if len(flag.Args()) < 1 {
 		flag.Usage()
 		return
 	}
 
-	begin := time.Date(2010, 2, 22, 22, 57, 23, 71877000, time.UTC)
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	chunker, err := NewChunker(*chunkPolicy, *chunkMin, *chunkMax, rng)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduler, err := NewScheduler(*schedPolicy, rng)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proto := Protocol{Extended: *extended}
+	xfers, err := prepare(proto, flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
 	if err != nil {
 		log.Fatal(err)
 	}
+	pcap.Rand = rng
 
 	pcap.WriteStandardHeader()
 
-	cli, srv := pcapwriter.NewICMPv4Taps(pcap, 11, 55)
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
-	go sink(srv, wg)
-	go sink(cli, wg)
+	key := answerkey.New(pcap, nil)
+	cookedA, cookedB := pcapwriter.NewICMPv4Writers(pcap, 11, pcap, 55)
+	client, server := answerkey.Endpoints(&cookedA.IPv4Base)
+	rec := key.NewConversation("netarch-25000", client, server)
+	rec.Decode = encode
+	for _, x := range xfers {
+		if err := addFile(rec, x); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	converse(cli, srv, flag.Args())
+	conv := pcapwriter.NewConversation(rec.ClientWriter(cookedA), rec.ServerWriter(cookedB))
+	converse(conv.Client(), conv.Server(), proto, xfers, chunker, scheduler, rng)
 
-	cli.Close()
-	srv.Close()
-	wg.Wait()
+	if *keyFile != "" {
+		if err := key.WriteFile(*keyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
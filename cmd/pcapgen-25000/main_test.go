@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	files := []string{"testdata/alpha.txt", "testdata/bravo.bin"}
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{nil, "default.pcap"},
+		{[]string{"-chunk", "random", "-schedule", "bursty"}, "random-bursty.pcap"},
+		{[]string{"-chunk", "shrink", "-schedule", "weighted", "-extended"}, "shrink-weighted-extended.pcap"},
+		{[]string{"-dissector"}, "netarch-25000.lua"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append(append(fixed, c.flags...), files...)
+			got := golden.Run(t, nil, args...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
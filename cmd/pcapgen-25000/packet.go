@@ -3,17 +3,31 @@ package main
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 )
 
 var ByteOrder = binary.LittleEndian
 var ErrShortData = errors.New("short data")
+var ErrTooManySessions = errors.New("too many sessions")
+var ErrNameTooLong = errors.New("file name too long")
+var ErrFileTooLarge = errors.New("file too large")
 
 var key = []byte{
 	0x70, 0x65, 0x67, 0x6d, 0x0a, 0x53, 0x45, 0x5f,
 	0x0a, 0x4d, 0x45, 0x5e, 0x0a, 0x43, 0x5e, 0x0b,
 }
 
+// Opcodes
+const (
+	OpAck          = 0x00
+	OpXferBegin    = 0x01
+	OpXfer         = 0x02
+	OpXferBeginExt = 0x11
+	OpXferExt      = 0x12
+)
+
 func encode(buf []byte) []byte {
 	obuf := make([]byte, len(buf))
 	for i, b := range buf {
@@ -27,22 +41,95 @@ func header(opcode uint8, session uint8) []byte {
 	return []byte{opcode, 0, session, 0}
 }
 
+// extHeader uses the pad byte after session as the high byte of a 16-bit session
+func extHeader(opcode uint8, session uint16) []byte {
+	buf := []byte{opcode, 0}
+	return ByteOrder.AppendUint16(buf, session)
+}
+
 func AckPacket() []byte {
-	buf := header(0, 0)
+	buf := header(OpAck, 0)
 	return encode(buf)
 }
 
-func XferBeginPacket(session uint8, size uint32, name string) []byte {
-	buf := header(1, session)
-	buf = ByteOrder.AppendUint32(buf, size)
-	buf = append(buf, uint8(len(name)))
+// MaxExtName is the longest file name whose extended XferBegin packet,
+// with its 14-byte header, still fits in the largest IPv4 datagram,
+// after IPv4 and ICMP headers.
+const MaxExtName = 65535 - 20 - 8 - 14
+
+// Protocol builds transfer packets.
+//
+// The original protocol allows 256 sessions, 255-byte file names,
+// and 4GiB files.
+// The extended protocol allows 65536 sessions, MaxExtName-byte file names,
+// and 64-bit file sizes.
+type Protocol struct {
+	Extended bool
+}
+
+// MaxSessions returns the number of sessions p can multiplex
+func (p Protocol) MaxSessions() int {
+	if p.Extended {
+		return math.MaxUint16 + 1
+	}
+	return math.MaxUint8 + 1
+}
+
+// Check returns an error if a transfer can't be represented by p.
+func (p Protocol) Check(session int, size int64, name string) error {
+	maxName := math.MaxUint8
+	var maxSize int64 = math.MaxUint32
+	if p.Extended {
+		maxName = MaxExtName
+		maxSize = math.MaxInt64
+	}
+
+	if session < 0 || session >= p.MaxSessions() {
+		return fmt.Errorf("%w: session %d, limit is %d", ErrTooManySessions, session, p.MaxSessions())
+	}
+	if len(name) > maxName {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrNameTooLong, len(name), maxName)
+	}
+	if size < 0 || size > maxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrFileTooLarge, size, maxSize)
+	}
+	return nil
+}
+
+func (p Protocol) XferBeginPacket(session int, size int64, name string) ([]byte, error) {
+	if err := p.Check(session, size, name); err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	if p.Extended {
+		buf = extHeader(OpXferBeginExt, uint16(session))
+		buf = ByteOrder.AppendUint64(buf, uint64(size))
+		buf = ByteOrder.AppendUint16(buf, uint16(len(name)))
+	} else {
+		buf = header(OpXferBegin, uint8(session))
+		buf = ByteOrder.AppendUint32(buf, uint32(size))
+		buf = append(buf, uint8(len(name)))
+	}
 	buf = append(buf, []byte(name)...)
-	return encode(buf)
+	return encode(buf), nil
 }
 
-func XferPacket(session uint8, r io.Reader) ([]byte, error) {
-	buf := header(2, session)
-	payload := make([]byte, 500)
+func (p Protocol) XferPacket(session int, r io.Reader, size int) ([]byte, error) {
+	if err := p.Check(session, 0, ""); err != nil {
+		return nil, err
+	}
+	if size > math.MaxUint16 {
+		return nil, fmt.Errorf("chunk size %d exceeds %d", size, math.MaxUint16)
+	}
+
+	var buf []byte
+	if p.Extended {
+		buf = extHeader(OpXferExt, uint16(session))
+	} else {
+		buf = header(OpXfer, uint8(session))
+	}
+	payload := make([]byte, size)
 	if n, err := r.Read(payload); err != nil {
 		return nil, err
 	} else {
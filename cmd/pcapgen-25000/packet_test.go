@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/payload"
+)
+
+func TestCheckLimits(t *testing.T) {
+	v1 := Protocol{}
+	v2 := Protocol{Extended: true}
+	longName := strings.Repeat("x", 256)
+
+	cases := []struct {
+		proto   Protocol
+		session int
+		size    int64
+		name    string
+		err     error
+	}{
+		{v1, 255, math.MaxUint32, strings.Repeat("x", 255), nil},
+		{v1, 256, 0, "a", ErrTooManySessions},
+		{v1, 0, math.MaxUint32 + 1, "a", ErrFileTooLarge},
+		{v1, 0, 0, longName, ErrNameTooLong},
+		{v2, 256, math.MaxUint32 + 1, longName, nil},
+		{v2, 65535, math.MaxInt64, strings.Repeat("x", MaxExtName), nil},
+		{v2, 65536, 0, "a", ErrTooManySessions},
+		{v2, 0, 0, strings.Repeat("x", MaxExtName+1), ErrNameTooLong},
+		{v2, 0, -1, "a", ErrFileTooLarge},
+	}
+	for _, c := range cases {
+		err := c.proto.Check(c.session, c.size, c.name)
+		if !errors.Is(err, c.err) {
+			t.Errorf("extended=%v session=%d size=%d len(name)=%d: wanted %v, got %v",
+				c.proto.Extended, c.session, c.size, len(c.name), c.err, err)
+		}
+	}
+}
+
+func TestXferBeginPacket(t *testing.T) {
+	if _, err := (Protocol{}).XferBeginPacket(256, 1, "a"); !errors.Is(err, ErrTooManySessions) {
+		t.Error("session 256 did not trigger error:", err)
+	}
+
+	buf, err := Protocol{}.XferBeginPacket(0xfe, 0x01020304, "moo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{OpXferBegin, 0, 0xfe, 0, 4, 3, 2, 1, 3, 'm', 'o', 'o'}
+	if got := encode(buf); !bytes.Equal(got, want) {
+		t.Errorf("wrong packet: %x", got)
+	}
+
+	buf, err = Protocol{Extended: true}.XferBeginPacket(0x1234, 0x0102030405, "moo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{OpXferBeginExt, 0, 0x34, 0x12, 5, 4, 3, 2, 1, 0, 0, 0, 3, 0, 'm', 'o', 'o'}
+	if got := encode(buf); !bytes.Equal(got, want) {
+		t.Errorf("wrong extended packet: %x", got)
+	}
+
+	// The longest name still fits in an ICMP echo
+	buf, err = Protocol{Extended: true}.XferBeginPacket(1, 1, strings.Repeat("x", MaxExtName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 65535-20-8 {
+		t.Errorf("longest name makes a %d-byte packet", len(buf))
+	}
+}
+
+func TestXferPacket(t *testing.T) {
+	r := strings.NewReader("chocolate")
+	buf, err := Protocol{Extended: true}.XferPacket(0x0100, r, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{OpXferExt, 0, 0, 1, 4, 0, 'c', 'h', 'o', 'c'}
+	if got := encode(buf); !bytes.Equal(got, want) {
+		t.Errorf("wrong packet: %x", got)
+	}
+
+	if _, err := (Protocol{}).XferPacket(1, r, math.MaxUint16+1); err == nil {
+		t.Error("oversized chunk did not trigger error")
+	}
+	if _, err := (Protocol{}).XferPacket(1, strings.NewReader(""), 4); err != io.EOF {
+		t.Error("empty reader did not return EOF:", err)
+	}
+}
+
+// The packet helpers, written as a payload template
+func TestTemplate(t *testing.T) {
+	tmpl := payload.New(nil)
+	tmpl.Counters["session"] = 0xfe
+	tmpl.Data = map[string]string{"Key": string(key)}
+	got, err := tmpl.Render(`{{$name := "moo"}}{{xor .Key (cat (u8 1) (u8 0) (counter "session" | u16le) (u32le 0x01020304) (len $name | u8) $name)}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Protocol{}.XferBeginPacket(0xfe, 0x01020304, "moo")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, wanted %x", got, want)
+	}
+}
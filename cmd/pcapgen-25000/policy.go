@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+// MaxChunk is the largest chunk that fits in one Ethernet frame,
+// after IPv4, ICMP, and xfer headers.
+const MaxChunk = 1500 - 20 - 8 - 6
+
+// transfer tracks one multiplexed file transfer
+type transfer struct {
+	session   int
+	name      string
+	offset    int64
+	remaining int64
+	chunks    int
+	done      bool
+}
+
+// Read reads the next chunk of the file.
+//
+// The file is only held open during the read,
+// so thousands of transfers can be multiplexed without running out of descriptors.
+func (x *transfer) Read(p []byte) (int, error) {
+	f, err := os.Open(x.name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := f.ReadAt(p, x.offset)
+	x.offset += int64(n)
+	x.remaining -= int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// A Chunker decides how many bytes go into the next chunk of x.
+type Chunker interface {
+	Size(x *transfer) int
+}
+
+// FixedChunks always sends the same size chunk.
+type FixedChunks int
+
+func (c FixedChunks) Size(x *transfer) int {
+	return int(c)
+}
+
+// RandomChunks picks a chunk size uniformly from [Min, Max].
+type RandomChunks struct {
+	Min, Max int
+	Rand     *rand.Rand
+}
+
+func (c RandomChunks) Size(x *transfer) int {
+	return c.Min + c.Rand.Intn(c.Max-c.Min+1)
+}
+
+// ShrinkingChunks starts each transfer at Max,
+// and shrinks by Step for every chunk sent, down to Min.
+type ShrinkingChunks struct {
+	Min, Max, Step int
+}
+
+func (c ShrinkingChunks) Size(x *transfer) int {
+	n := c.Max - x.chunks*c.Step
+	if n < c.Min {
+		return c.Min
+	}
+	return n
+}
+
+// NewChunker returns the Chunker called name
+func NewChunker(name string, min, max int, rng *rand.Rand) (Chunker, error) {
+	if min < 1 || max > MaxChunk || min > max {
+		return nil, fmt.Errorf("chunk sizes must satisfy 1 <= min <= max <= %d", MaxChunk)
+	}
+	switch name {
+	case "fixed":
+		return FixedChunks(max), nil
+	case "random":
+		return RandomChunks{Min: min, Max: max, Rand: rng}, nil
+	case "shrink":
+		step := (max - min) / 8
+		if step < 1 {
+			step = 1
+		}
+		return ShrinkingChunks{Min: min, Max: max, Step: step}, nil
+	}
+	return nil, fmt.Errorf("unknown chunk policy: %s", name)
+}
+
+// A Scheduler picks which transfer sends the next chunk.
+//
+// Next is only called while at least one transfer is not done,
+// and must return the index of a transfer that is not done.
+type Scheduler interface {
+	Next(xfers []*transfer) int
+}
+
+// RoundRobin cycles through transfers one chunk at a time.
+type RoundRobin struct {
+	next int
+}
+
+func (s *RoundRobin) Next(xfers []*transfer) int {
+	for i := 0; i < len(xfers); i += 1 {
+		idx := (s.next + i) % len(xfers)
+		if !xfers[idx].done {
+			s.next = idx + 1
+			return idx
+		}
+	}
+	return -1
+}
+
+// Sequential sends each transfer to completion before starting the next.
+type Sequential struct{}
+
+func (Sequential) Next(xfers []*transfer) int {
+	for i, x := range xfers {
+		if !x.done {
+			return i
+		}
+	}
+	return -1
+}
+
+// WeightedRandom picks transfers at random,
+// weighted by how many bytes each has left to send.
+type WeightedRandom struct {
+	Rand *rand.Rand
+}
+
+func (s WeightedRandom) Next(xfers []*transfer) int {
+	var total int64
+	for _, x := range xfers {
+		if !x.done {
+			total += x.remaining + 1
+		}
+	}
+	pick := s.Rand.Int63n(total)
+	for i, x := range xfers {
+		if x.done {
+			continue
+		}
+		pick -= x.remaining + 1
+		if pick < 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Bursty sends a random-length burst of chunks from one transfer,
+// then switches to another at random.
+type Bursty struct {
+	MaxBurst int
+	Rand     *rand.Rand
+	current  int
+	left     int
+}
+
+func (s *Bursty) Next(xfers []*transfer) int {
+	if s.left > 0 && !xfers[s.current].done {
+		s.left -= 1
+		return s.current
+	}
+
+	active := make([]int, 0, len(xfers))
+	for i, x := range xfers {
+		if !x.done {
+			active = append(active, i)
+		}
+	}
+	s.current = active[s.Rand.Intn(len(active))]
+	s.left = s.Rand.Intn(s.MaxBurst)
+	return s.current
+}
+
+// NewScheduler returns the Scheduler called name
+func NewScheduler(name string, rng *rand.Rand) (Scheduler, error) {
+	switch name {
+	case "rr":
+		return new(RoundRobin), nil
+	case "sequential":
+		return Sequential{}, nil
+	case "weighted":
+		return WeightedRandom{Rand: rng}, nil
+	case "bursty":
+		return &Bursty{MaxBurst: 8, Rand: rng}, nil
+	}
+	return nil, fmt.Errorf("unknown scheduling policy: %s", name)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNewChunker(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	cases := []struct {
+		name     string
+		min, max int
+		ok       bool
+	}{
+		{"fixed", 1, MaxChunk, true},
+		{"random", 1, 1, true},
+		{"shrink", 100, 200, true},
+		{"fixed", 0, 10, false},
+		{"random", 1, MaxChunk + 1, false},
+		{"shrink", 20, 10, false},
+		{"huge", 1, 10, false},
+	}
+	for _, c := range cases {
+		_, err := NewChunker(c.name, c.min, c.max, rng)
+		if (err == nil) != c.ok {
+			t.Errorf("%s %d-%d: wanted ok=%v, got %v", c.name, c.min, c.max, c.ok, err)
+		}
+	}
+}
+
+func TestChunkBounds(t *testing.T) {
+	for _, name := range []string{"fixed", "random", "shrink"} {
+		for _, r := range [][2]int{{1, 1}, {1, 2}, {10, 100}, {1, MaxChunk}} {
+			c, err := NewChunker(name, r[0], r[1], rand.New(rand.NewSource(1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			x := new(transfer)
+			for x.chunks = 0; x.chunks < 1000; x.chunks += 1 {
+				if n := c.Size(x); n < r[0] || n > r[1] {
+					t.Errorf("%s %d-%d: chunk %d is %d bytes", name, r[0], r[1], x.chunks, n)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestShrinkingChunks(t *testing.T) {
+	c := ShrinkingChunks{Min: 10, Max: 40, Step: 8}
+	want := []int{40, 32, 24, 16, 10, 10, 10}
+	x := new(transfer)
+	for i, w := range want {
+		x.chunks = i
+		if got := c.Size(x); got != w {
+			t.Errorf("chunk %d: wanted %d bytes, got %d", i, w, got)
+		}
+	}
+
+	// Each transfer starts over at Max
+	if got := c.Size(new(transfer)); got != 40 {
+		t.Errorf("new transfer: wanted 40 bytes, got %d", got)
+	}
+}
+
+// schedule runs s over transfers needing the given number of chunks,
+// and returns the order they were picked in.
+func schedule(t *testing.T, s Scheduler, chunks ...int) []int {
+	xfers := make([]*transfer, len(chunks))
+	total := 0
+	for i, n := range chunks {
+		xfers[i] = &transfer{session: i, remaining: int64(n), done: n == 0}
+		total += n
+	}
+
+	var order []int
+	for len(order) < total {
+		i := s.Next(xfers)
+		if i < 0 || i >= len(xfers) {
+			t.Fatalf("picked transfer %d after %v", i, order)
+		}
+		x := xfers[i]
+		if x.done {
+			t.Fatalf("picked finished transfer %d after %v", i, order)
+		}
+		x.remaining -= 1
+		x.chunks += 1
+		x.done = x.remaining == 0
+		order = append(order, i)
+	}
+	for i, x := range xfers {
+		if !x.done {
+			t.Errorf("transfer %d never finished", i)
+		}
+	}
+	return order
+}
+
+func TestRoundRobin(t *testing.T) {
+	got := schedule(t, new(RoundRobin), 3, 1, 0, 2)
+	want := []int{0, 1, 3, 0, 3, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wanted %v, got %v", want, got)
+		}
+	}
+}
+
+func TestSequential(t *testing.T) {
+	got := schedule(t, Sequential{}, 2, 0, 3)
+	want := []int{0, 0, 2, 2, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wanted %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRandomSchedulers(t *testing.T) {
+	cases := map[string]Scheduler{
+		"weighted": WeightedRandom{Rand: rand.New(rand.NewSource(1))},
+		"bursty":   &Bursty{MaxBurst: 8, Rand: rand.New(rand.NewSource(1))},
+	}
+	for name, s := range cases {
+		t.Run(name, func(t *testing.T) {
+			order := schedule(t, s, 200, 200, 200, 1)
+
+			// Every transfer gets a turn before the others are done
+			first := make(map[int]int)
+			for i, x := range order {
+				if _, ok := first[x]; !ok {
+					first[x] = i
+				}
+			}
+			for x := 0; x < 3; x += 1 {
+				if first[x] > 300 {
+					t.Errorf("transfer %d waited until chunk %d", x, first[x])
+				}
+			}
+		})
+	}
+}
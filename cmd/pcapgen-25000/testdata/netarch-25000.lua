@@ -0,0 +1,142 @@
+-- Wireshark dissector for netarch-25000, generated by pcapgen.
+--
+-- Load with: wireshark -X lua_script:netarch_25000.lua
+
+local proto = Proto("netarch_25000", "netarch-25000")
+
+local names = {[0] = "ack", [1] = "xfer-begin", [2] = "xfer", [17] = "xfer-begin-ext", [18] = "xfer-ext"}
+
+local f_opcode = ProtoField.uint8("netarch_25000.opcode", "opcode", base.HEX, names)
+local f_pad = ProtoField.uint8("netarch_25000.pad", "pad")
+local f_session = ProtoField.uint16("netarch_25000.session", "session")
+local f_size = ProtoField.uint32("netarch_25000.size", "size")
+local f_name_length = ProtoField.uint8("netarch_25000.name_length", "name-length")
+local f_name = ProtoField.bytes("netarch_25000.name", "name")
+local f_length = ProtoField.uint16("netarch_25000.length", "length")
+local f_data = ProtoField.bytes("netarch_25000.data", "data")
+local f_size_64 = ProtoField.uint64("netarch_25000.size_64", "size")
+local f_name_length_16 = ProtoField.uint16("netarch_25000.name_length_16", "name-length")
+
+proto.fields = {f_opcode, f_pad, f_session, f_size, f_name_length, f_name, f_length, f_data, f_size_64, f_name_length_16}
+
+local key = {0x70, 0x65, 0x67, 0x6d, 0x0a, 0x53, 0x45, 0x5f, 0x0a, 0x4d, 0x45, 0x5e, 0x0a, 0x43, 0x5e, 0x0b}
+
+-- deobfuscate undoes the XOR with key
+local function deobfuscate(tvb)
+	if #key == 0 then
+		return tvb
+	end
+	local ba = tvb:bytes()
+	for i = 0, ba:len() - 1 do
+		ba:set_index(i, bit.bxor(ba:get_index(i), key[i % #key + 1]))
+	end
+	return ba:tvb("Decoded netarch-25000")
+end
+
+-- looks_like says whether tvb starts with a header and a known opcode
+local function looks_like(tvb)
+	if tvb:len() < 4 then
+		return false
+	end
+	local op = 0
+	for i = 0, 0 do
+		local b = tvb(0 + i, 1):uint()
+		if #key > 0 then
+			b = bit.bxor(b, key[(0 + i) % #key + 1])
+		end
+		op = op + b * 256 ^ i
+	end
+	return names[op] ~= nil
+end
+
+local function dissect(tvb, pinfo, tree)
+	local plain = deobfuscate(tvb)
+	local subtree = tree:add(proto, tvb(), "netarch-25000")
+	local values = {}
+	local off = 0
+	local n
+
+	pinfo.cols.protocol = "netarch-25000"
+	if plain:len() < off + 1 then return false end
+	values["opcode"] = plain(off, 1):le_uint()
+	subtree:add_le(f_opcode, plain(off, 1))
+	off = off + 1
+	if plain:len() < off + 1 then return false end
+	values["pad"] = plain(off, 1):le_uint()
+	subtree:add_le(f_pad, plain(off, 1))
+	off = off + 1
+	if plain:len() < off + 2 then return false end
+	values["session"] = plain(off, 2):le_uint()
+	subtree:add_le(f_session, plain(off, 2))
+	off = off + 2
+
+	local op = values["opcode"]
+	if op == 0 then
+	elseif op == 1 then
+		if plain:len() < off + 4 then return false end
+		values["size"] = plain(off, 4):le_uint()
+		subtree:add_le(f_size, plain(off, 4))
+		off = off + 4
+		if plain:len() < off + 1 then return false end
+		values["name-length"] = plain(off, 1):le_uint()
+		subtree:add_le(f_name_length, plain(off, 1))
+		off = off + 1
+		n = values["name-length"]
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_name, plain(off, n)) end
+		off = off + n
+	elseif op == 2 then
+		if plain:len() < off + 2 then return false end
+		values["length"] = plain(off, 2):le_uint()
+		subtree:add_le(f_length, plain(off, 2))
+		off = off + 2
+		n = values["length"]
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_data, plain(off, n)) end
+		off = off + n
+	elseif op == 17 then
+		if plain:len() < off + 8 then return false end
+		values["size"] = plain(off, 8):le_uint64():tonumber()
+		subtree:add_le(f_size_64, plain(off, 8))
+		off = off + 8
+		if plain:len() < off + 2 then return false end
+		values["name-length"] = plain(off, 2):le_uint()
+		subtree:add_le(f_name_length_16, plain(off, 2))
+		off = off + 2
+		n = values["name-length"]
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_name, plain(off, n)) end
+		off = off + n
+	elseif op == 18 then
+		if plain:len() < off + 2 then return false end
+		values["length"] = plain(off, 2):le_uint()
+		subtree:add_le(f_length, plain(off, 2))
+		off = off + 2
+		n = values["length"]
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_data, plain(off, n)) end
+		off = off + n
+	end
+
+	pinfo.cols.info = names[op] or ("unknown opcode " .. tostring(op))
+	return true
+end
+
+local icmp_type_field = Field.new("icmp.type")
+local data_field = Field.new("data")
+
+function proto.dissector(tvb, pinfo, tree)
+	-- Called as a postdissector: pick out the ICMP payload
+	local icmp_type = icmp_type_field()
+	local data = data_field()
+	if not icmp_type or not data then
+		return
+	end
+	local t = icmp_type.value
+	if (t ~= 0 and t ~= 8) or not looks_like(data.range:tvb()) then
+		return
+	end
+	dissect(data.range:tvb(), pinfo, tree)
+end
+
+register_postdissector(proto)
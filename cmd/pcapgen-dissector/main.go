@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/layer"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-udp PORT | -icmp] PROTOCOL.json > dissector.lua\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Writes a Wireshark Lua dissector for a protocol description,")
+	fmt.Fprintln(out, "in the JSON form of layer.Protocol.")
+	fmt.Fprintln(out, "Key, if present, is base64.")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "The dissector tries every UDP payload heuristically,")
+	fmt.Fprintln(out, "or with -icmp, every ICMP echo payload.")
+}
+
+func main() {
+	flag.Usage = usage
+	port := flag.Uint("udp", 0, "Also register the dissector on this UDP port")
+	icmp := flag.Bool("icmp", false, "Look in ICMP echo payloads instead of UDP")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		return
+	}
+
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var proto layer.Protocol
+	if err := json.Unmarshal(data, &proto); err != nil {
+		log.Fatal(err)
+	}
+	d := layer.Dissector{UDPPort: uint16(*port), ICMP: *icmp}
+	if err := proto.WriteDissector(os.Stdout, d); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{[]string{"-udp", "9999", "testdata/chat.json"}, "chat-udp.lua"},
+		{[]string{"-icmp", "testdata/chat.json"}, "chat-icmp.lua"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, c.flags...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+-- Wireshark dissector for Chat, generated by pcapgen.
+--
+-- Load with: wireshark -X lua_script:chat.lua
+
+local proto = Proto("chat", "Chat")
+
+local names = {[1] = "say", [2] = "bye"}
+
+local f_op = ProtoField.uint8("chat.op", "op", base.HEX, names)
+local f_seq = ProtoField.uint32("chat.seq", "seq")
+local f_nick_len = ProtoField.uint8("chat.nick_len", "nick-len")
+local f_nick = ProtoField.bytes("chat.nick", "nick")
+local f_text = ProtoField.bytes("chat.text", "text")
+
+proto.fields = {f_op, f_seq, f_nick_len, f_nick, f_text}
+
+local key = {0xaa, 0x55}
+
+-- deobfuscate undoes the XOR with key
+local function deobfuscate(tvb)
+	if #key == 0 then
+		return tvb
+	end
+	local ba = tvb:bytes()
+	for i = 0, ba:len() - 1 do
+		ba:set_index(i, bit.bxor(ba:get_index(i), key[i % #key + 1]))
+	end
+	return ba:tvb("Decoded Chat")
+end
+
+-- looks_like says whether tvb starts with a header and a known opcode
+local function looks_like(tvb)
+	if tvb:len() < 5 then
+		return false
+	end
+	local op = 0
+	for i = 0, 0 do
+		local b = tvb(0 + i, 1):uint()
+		if #key > 0 then
+			b = bit.bxor(b, key[(0 + i) % #key + 1])
+		end
+		op = op * 256 + b
+	end
+	return names[op] ~= nil
+end
+
+local function dissect(tvb, pinfo, tree)
+	local plain = deobfuscate(tvb)
+	local subtree = tree:add(proto, tvb(), "Chat")
+	local values = {}
+	local off = 0
+	local n
+
+	pinfo.cols.protocol = "Chat"
+	if plain:len() < off + 1 then return false end
+	values["op"] = plain(off, 1):uint()
+	subtree:add(f_op, plain(off, 1))
+	off = off + 1
+	if plain:len() < off + 4 then return false end
+	values["seq"] = plain(off, 4):uint()
+	subtree:add(f_seq, plain(off, 4))
+	off = off + 4
+
+	local op = values["op"]
+	if op == 1 then
+		if plain:len() < off + 1 then return false end
+		values["nick-len"] = plain(off, 1):uint()
+		subtree:add(f_nick_len, plain(off, 1))
+		off = off + 1
+		n = values["nick-len"]
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_nick, plain(off, n)) end
+		off = off + n
+		n = plain:len() - off
+		if plain:len() < off + n then return false end
+		if n > 0 then subtree:add(f_text, plain(off, n)) end
+		off = off + n
+	elseif op == 2 then
+	end
+
+	pinfo.cols.info = names[op] or ("unknown opcode " .. tostring(op))
+	return true
+end
+
+function proto.dissector(tvb, pinfo, tree)
+	dissect(tvb, pinfo, tree)
+	return tvb:len()
+end
+
+local function heuristic(tvb, pinfo, tree)
+	if not looks_like(tvb) then
+		return false
+	end
+	dissect(tvb, pinfo, tree)
+	return true
+end
+proto:register_heuristic("udp", heuristic)
+DissectorTable.get("udp.port"):add(9999, proto)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/dns"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [FILE...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Exfiltrates all listed files through DNS query names,")
+	fmt.Fprintln(out, "and downloads files given with -down through DNS answers.")
+}
+
+func send(name string, f func(string, io.Reader) error) {
+	file, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	if err := f(name, file); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	domain := flag.String("domain", "t.example.com", "Tunnel domain")
+	encoding := flag.String("encoding", "base32", "Query label encoding: base32, hex")
+	labelLen := flag.Int("label-len", 63, "Longest data label in a query (1-63)")
+	answer := flag.String("answer", "TXT", "Answer record type: TXT, NULL")
+	answerLen := flag.Int("answer-len", 180, "Largest chunk of download data in one answer")
+	pace := flag.Duration("pace", 500*time.Millisecond, "Delay between exchanges")
+	down := flag.String("down", "", "Comma-separated files to send from server to client")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address and IP address")
+	dstN := flag.Uint("dst", 53, "Value to use for server MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for transaction IDs, ports, and jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 1 && *down == "" {
+		flag.Usage()
+		return
+	}
+
+	answerType, err := dns.ParseType(*answer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if answerType != dns.TypeTXT && answerType != dns.TypeNULL {
+		log.Fatal("Answer type must be TXT or NULL")
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rng
+	pcap.WriteStandardHeader()
+
+	g := dns.NewGenerator(pcap, uint8(*srcN), uint8(*dstN))
+	g.Rand = rng
+	tun := dns.NewTunnel(g, *domain)
+	tun.Encoding = *encoding
+	tun.LabelLen = *labelLen
+	tun.AnswerType = answerType
+	tun.AnswerLen = *answerLen
+	tun.Pace = *pace
+	tun.Clock = pcap
+
+	for _, name := range flag.Args() {
+		send(name, tun.Upload)
+	}
+	if *down != "" {
+		for _, name := range strings.Split(*down, ",") {
+			send(name, tun.Download)
+		}
+	}
+}
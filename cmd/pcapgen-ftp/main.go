@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/ftp"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [FILE...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Downloads all listed files over FTP,")
+	fmt.Fprintln(out, "and uploads files given with -upload.")
+}
+
+func main() {
+	flag.Usage = usage
+	user := flag.String("user", "anonymous", "Username")
+	pass := flag.String("pass", "guest@example.com", "Password")
+	active := flag.Bool("active", false, "Use active mode (PORT) instead of passive mode (PASV)")
+	list := flag.Bool("list", true, "List the directory before downloading")
+	upload := flag.String("upload", "", "Comma-separated files to send from client to server")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address and IP address")
+	dstN := flag.Uint("dst", 21, "Value to use for server MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 1 && *upload == "" {
+		flag.Usage()
+		return
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	session := &ftp.Session{
+		Username: *user,
+		Password: *pass,
+		Passive:  !*active,
+	}
+	var downloads []ftp.Transfer
+	for _, name := range flag.Args() {
+		x, err := ftp.FileTransfer(ftp.RETR, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		downloads = append(downloads, x)
+	}
+	if *list {
+		session.Transfers = append(session.Transfers, ftp.Listing(begin.Add(-24*time.Hour), downloads...))
+	}
+	session.Transfers = append(session.Transfers, downloads...)
+	if *upload != "" {
+		for _, name := range strings.Split(*upload, ",") {
+			x, err := ftp.FileTransfer(ftp.STOR, name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			session.Transfers = append(session.Transfers, x)
+		}
+	}
+
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	if err := session.Write(pcap, uint8(*srcN), uint8(*dstN)); err != nil {
+		log.Fatal(err)
+	}
+}
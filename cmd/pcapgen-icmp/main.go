@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/icmp"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s FILE [FILE...] > out.pcap\n", os.Args[0])
+	fmt.Fprintf(out, "       %s -ping COUNT > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Exfiltrates the listed files through pings,")
+	fmt.Fprintln(out, "hiding the data in the header field given by -field.")
+	fmt.Fprintln(out, "The ttl field only carries bytes up to 0xdf, so it suits text, not binary files.")
+	fmt.Fprintln(out, "With -ping, just pings, like the ping command would.")
+}
+
+func parseStyle(name string) icmp.Style {
+	switch name {
+	case "linux":
+		return icmp.Linux
+	case "windows":
+		return icmp.Windows
+	}
+	log.Fatal("Unknown ping style:", name)
+	return 0
+}
+
+// ping writes an ordinary ping run
+func ping(pcap *pcapwriter.Writer, src, dst uint8, style icmp.Style, interval time.Duration, count int, lose string, router uint8) {
+	lost := make(map[int]bool)
+	if lose != "" {
+		for _, v := range strings.Split(lose, ",") {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			lost[n] = true
+		}
+	}
+
+	p := icmp.NewPing(pcap, src, dst, style)
+	p.Interval = interval
+	p.RTT = 8 * time.Millisecond
+	p.Clock = pcap
+	for i := 1; i <= count; i++ {
+		var err error
+		switch {
+		case router != 0:
+			err = p.Unreachable(router, layers.ICMPv4CodeHost)
+		case lost[i]:
+			err = p.Unanswered()
+		default:
+			err = p.Echo(nil)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	fieldName := flag.String("field", "id", "Hide data in: id, seq, ipid, ttl, timestamp, padding")
+	styleName := flag.String("style", "linux", "Imitate ping from: linux, windows")
+	interval := flag.Duration("interval", time.Second, "Time between requests")
+	count := flag.Int("ping", 0, "Send this many ordinary pings instead")
+	lose := flag.String("lose", "", "Comma-separated sequence numbers of pings that get no reply")
+	unreachable := flag.Uint("unreachable", 0, "Have this router answer every ping with host unreachable")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address and IP address")
+	dstN := flag.Uint("dst", 55, "Value to use for server MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 1 && *count == 0 {
+		flag.Usage()
+		return
+	}
+
+	field, err := icmp.ParseField(*fieldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	style := parseStyle(*styleName)
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	if *count > 0 {
+		ping(pcap, uint8(*srcN), uint8(*dstN), style, *interval, *count, *lose, uint8(*unreachable))
+		return
+	}
+
+	c := icmp.NewCovert(pcap, uint8(*srcN), uint8(*dstN), field)
+	c.Style = style
+	c.Interval = *interval
+	c.Clock = pcap
+	for _, name := range flag.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := c.Write(data); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
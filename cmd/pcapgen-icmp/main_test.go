@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{[]string{"testdata/flag.txt"}, "covert-id.pcap"},
+		{[]string{"-field", "ttl", "-style", "windows", "testdata/flag.txt"}, "covert-ttl.pcap"},
+		{[]string{"-field", "padding", "-interval", "200ms", "testdata/flag.txt"}, "covert-padding.pcap"},
+		{[]string{"-ping", "5", "-lose", "3,4"}, "ping-linux.pcap"},
+		{[]string{"-ping", "4", "-style", "windows", "-unreachable", "1"}, "ping-unreachable.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, append(fixed, c.flags...)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
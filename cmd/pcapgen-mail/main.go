@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/mail"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [ATTACHMENT...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Sends a message with every listed file attached over SMTP,")
+	fmt.Fprintln(out, "then has the recipient retrieve it with POP3 or IMAP.")
+}
+
+// session runs write over a new TCP connection from client to server on port
+func session(pcap *pcapwriter.Writer, client, server uint8, port uint16, write func(io.Writer, io.Writer) error) {
+	cli, srv := pcapwriter.NewTCPv4Writers(pcap, client, pcap, server)
+	cli.SrcPort = layers.TCPPort(40000 + uint16(pcap.Frames))
+	cli.DstPort = layers.TCPPort(port)
+	srv.SrcPort = layers.TCPPort(port)
+	srv.DstPort = cli.SrcPort
+	if err := cli.Connect(); err != nil {
+		log.Fatal(err)
+	}
+	if err := write(cli, srv); err != nil {
+		log.Fatal(err)
+	}
+	cli.Close()
+	srv.Close()
+}
+
+func main() {
+	flag.Usage = usage
+	from := flag.String("from", "Alice <alice@example.com>", "Sender")
+	to := flag.String("to", "bob@example.net", "Comma-separated recipients")
+	subject := flag.String("subject", "Files", "Subject")
+	bodyFile := flag.String("body", "", "Read the message body from this file")
+	user := flag.String("user", "alice", "SMTP username; empty to skip AUTH")
+	pass := flag.String("pass", "hunter2", "SMTP password")
+	auth := flag.String("auth", "PLAIN", "SMTP auth mechanism: PLAIN, LOGIN")
+	retrieve := flag.String("retrieve", "pop3", "Retrieve with: pop3, imap, none")
+	rcptUser := flag.String("rcpt-user", "bob", "POP3/IMAP username")
+	rcptPass := flag.String("rcpt-pass", "swordfish", "POP3/IMAP password")
+	srcN := flag.Uint("src", 11, "Value to use for sender MAC address and IP address")
+	dstN := flag.Uint("dst", 25, "Value to use for mail server MAC address and IP address")
+	rcptN := flag.Uint("rcpt", 12, "Value to use for recipient MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	msg := mail.Message{
+		From:      *from,
+		To:        strings.Split(*to, ","),
+		Subject:   *subject,
+		Date:      begin,
+		MessageID: fmt.Sprintf("%d.pcapgen@example.com", begin.Unix()),
+	}
+	if *bodyFile != "" {
+		body, err := os.ReadFile(*bodyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msg.Body = string(body)
+	}
+	for _, name := range flag.Args() {
+		a, err := mail.FileAttachment(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msg.Attachments = append(msg.Attachments, a)
+	}
+
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	smtp := &mail.SMTP{
+		ServerName: "mail.example.net",
+		ClientName: "workstation",
+		Username:   *user,
+		Password:   *pass,
+		Auth:       *auth,
+		Messages:   []mail.Message{msg},
+	}
+	port := uint16(mail.SMTPPort)
+	if *user != "" {
+		port = mail.SubmissionPort
+	}
+	session(pcap, uint8(*srcN), uint8(*dstN), port, smtp.Write)
+
+	pcap.Sleep(time.Minute)
+	switch *retrieve {
+	case "pop3":
+		pop := &mail.POP3{ServerName: "mail.example.net", Username: *rcptUser, Password: *rcptPass, Messages: smtp.Messages}
+		session(pcap, uint8(*rcptN), uint8(*dstN), mail.POP3Port, pop.Write)
+	case "imap":
+		imap := &mail.IMAP{ServerName: "mail.example.net", Username: *rcptUser, Password: *rcptPass, Messages: smtp.Messages}
+		session(pcap, uint8(*rcptN), uint8(*dstN), mail.IMAPPort, imap.Write)
+	case "none":
+	default:
+		log.Fatal("Unknown retrieval protocol:", *retrieve)
+	}
+}
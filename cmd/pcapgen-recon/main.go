@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/recon"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s -traceroute HOPS > out.pcap\n", os.Args[0])
+	fmt.Fprintf(out, "       %s -scan KIND -addrs RANGE > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "HOPS is a comma-separated list of router addresses, with * for a router that never answers.")
+	fmt.Fprintln(out, "KIND is syn, udp, or ping.")
+	fmt.Fprintln(out, "RANGE and port lists look like 20-30,40.")
+	fmt.Fprintln(out, "Hosts listed in -up are up, with open ports after a colon: 20:22/80,25")
+}
+
+// parseRange parses a list like 20-30,40
+func parseRange(s string, max int) []int {
+	var ret []int
+	for _, v := range strings.Split(s, ",") {
+		if v == "" {
+			continue
+		}
+		lo, hi := v, v
+		if i := strings.Index(v, "-"); i > 0 {
+			lo, hi = v[:i], v[i+1:]
+		}
+		a, err := strconv.Atoi(lo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := strconv.Atoi(hi)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if a > b || b > max {
+			log.Fatal("Bad range: ", v)
+		}
+		for n := a; n <= b; n++ {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func parsePorts(s string) []uint16 {
+	var ports []uint16
+	for _, p := range parseRange(s, 65535) {
+		ports = append(ports, uint16(p))
+	}
+	return ports
+}
+
+// parseUp parses a list of up hosts like 20:22/80,25
+func parseUp(s string, filtered []uint16) []recon.Target {
+	var targets []recon.Target
+	for _, v := range strings.Split(s, ",") {
+		if v == "" {
+			continue
+		}
+		addr, open := v, ""
+		if i := strings.Index(v, ":"); i >= 0 {
+			addr, open = v[:i], v[i+1:]
+		}
+		n, err := strconv.ParseUint(addr, 10, 8)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targets = append(targets, recon.Target{
+			Addr:     uint8(n),
+			Open:     parsePorts(strings.Replace(open, "/", ",", -1)),
+			Filtered: filtered,
+		})
+	}
+	return targets
+}
+
+func main() {
+	flag.Usage = usage
+	hops := flag.String("traceroute", "", "Trace the route through these routers")
+	useICMP := flag.Bool("icmp", false, "Trace with ICMP echo requests, like Windows tracert")
+	gateway := flag.Uint("gateway", 1, "Value to use for the gateway MAC address and IP address")
+	kind := flag.String("scan", "", "Scan the subnet: syn, udp, ping")
+	addrs := flag.String("addrs", "20-30", "Addresses to scan")
+	up := flag.String("up", "20:22/80,25:53", "Hosts that are up, and their open ports")
+	ports := flag.String("ports", "21-23,25,53,80,443", "Ports to scan")
+	filtered := flag.String("filtered", "", "Ports that never answer on any host")
+	delay := flag.Duration("delay", 5*time.Millisecond, "Time between scan probes")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address and IP address")
+	dstN := flag.Uint("dst", 55, "Value to use for traceroute destination MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if *hops == "" && *kind == "" {
+		flag.Usage()
+		return
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	if *hops != "" {
+		var ips []net.IP
+		for _, h := range strings.Split(*hops, ",") {
+			if h == "*" {
+				ips = append(ips, nil)
+				continue
+			}
+			ip := net.ParseIP(h)
+			if ip == nil {
+				log.Fatal("Bad router address: ", h)
+			}
+			ips = append(ips, ip)
+		}
+		t := recon.NewTraceroute(ips...)
+		t.ICMP = *useICMP
+		t.Rand = pcap.Rand
+		if err := t.Write(pcap, pcap, uint8(*srcN), uint8(*gateway), uint8(*dstN)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	s := &recon.Scan{
+		Kind:    *kind,
+		Targets: parseUp(*up, parsePorts(*filtered)),
+		Ports:   parsePorts(*ports),
+		Delay:   *delay,
+		RTT:     time.Millisecond,
+		Rand:    pcap.Rand,
+	}
+	for _, a := range parseRange(*addrs, 255) {
+		s.Addrs = append(s.Addrs, uint8(a))
+	}
+	if err := s.Write(pcap, pcap, uint8(*srcN)); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{[]string{"-traceroute", "192.168.1.1,*,203.0.113.9"}, "traceroute.pcap"},
+		{[]string{"-traceroute", "192.168.1.1,198.51.100.1", "-icmp"}, "tracert.pcap"},
+		{[]string{"-scan", "syn", "-addrs", "20-22", "-filtered", "443"}, "syn.pcap"},
+		{[]string{"-scan", "udp", "-addrs", "25", "-ports", "53,123,161"}, "udp.pcap"},
+		{[]string{"-scan", "ping"}, "ping.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, append(fixed, c.flags...)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/scenario"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s SCENARIO.yaml > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Renders a capture from a scenario file, in YAML or JSON.")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "# Example scenario")
+	fmt.Fprintln(out, "##################")
+	fmt.Fprintln(out, "hosts:")
+	fmt.Fprintln(out, "  victim: {addr: 11}")
+	fmt.Fprintln(out, "  c2: {addr: 55, ip: 203.0.113.7}")
+	fmt.Fprintln(out, "flows:")
+	fmt.Fprintln(out, "  - proto: tcp")
+	fmt.Fprintln(out, "    client: victim")
+	fmt.Fprintln(out, "    server: c2")
+	fmt.Fprintln(out, "    server-port: 4444")
+	fmt.Fprintln(out, "    at: 2s")
+	fmt.Fprintln(out, "    steps:")
+	fmt.Fprintln(out, "      - client: {text: \"hello\\n\"}")
+	fmt.Fprintln(out, "      - sleep: 1s")
+	fmt.Fprintln(out, "      - drop: 1")
+	fmt.Fprintln(out, "      - server: {file: payload.bin}")
+	fmt.Fprintln(out, "      - close: client")
+	fmt.Fprintln(out, "      - close: server")
+	fmt.Fprintln(out, "noise: {mix: \"dns=40,https=30,ntp=10,ping=20\", duration: 30s}")
+}
+
+func main() {
+	flag.Usage = usage
+	seed := flag.Int64("seed", 0, "Random seed for jitter, overriding the scenario's")
+	start := flag.String("start", "", "Timestamp of the first frame (RFC 3339), overriding the scenario's")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		return
+	}
+
+	s, err := scenario.Load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Any -seed overrides the scenario's, even -seed 0
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			s.Seed = *seed
+		}
+	})
+	if *start != "" {
+		if s.Start, err = time.Parse(time.RFC3339Nano, *start); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := s.Render(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
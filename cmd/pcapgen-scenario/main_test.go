@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		scenario string
+		golden   string
+	}{
+		{"testdata/exfil.yaml", "exfil.pcap"},
+		{"testdata/exfil.json", "json.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, append(fixed, c.scenario)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
+
+func TestSeedZero(t *testing.T) {
+	start := []string{"-start", "2010-02-22T22:57:23.071877Z"}
+	own := golden.Run(t, nil, append(start, "testdata/exfil.yaml")...)
+	zero := golden.Run(t, nil, append(start, "-seed", "0", "testdata/exfil.yaml")...)
+	if bytes.Equal(own, zero) {
+		t.Error("-seed 0 didn't override the scenario's seed")
+	}
+}
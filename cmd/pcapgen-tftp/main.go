@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/tftp"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [FILE...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Reads all listed files from a TFTP server,")
+	fmt.Fprintln(out, "and writes files given with -put to it.")
+}
+
+func main() {
+	flag.Usage = usage
+	put := flag.String("put", "", "Comma-separated files to send from client to server")
+	missing := flag.String("missing", "", "Comma-separated file names the server doesn't have")
+	blksize := flag.Int("blksize", 0, "Negotiate this block size with the blksize option")
+	pace := flag.Duration("pace", 2*time.Second, "Delay between transfers")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address and IP address")
+	dstN := flag.Uint("dst", 69, "Value to use for server MAC address and IP address")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for ports and jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 1 && *put == "" && *missing == "" {
+		flag.Usage()
+		return
+	}
+
+	var transfers []tftp.Transfer
+	if *missing != "" {
+		for _, name := range strings.Split(*missing, ",") {
+			transfers = append(transfers, tftp.Transfer{
+				Name: name,
+				Fail: &tftp.Error{Code: tftp.ErrNotFound, Message: "File not found"},
+			})
+		}
+	}
+	for _, name := range flag.Args() {
+		x, err := tftp.FileTransfer(false, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		transfers = append(transfers, x)
+	}
+	if *put != "" {
+		for _, name := range strings.Split(*put, ",") {
+			x, err := tftp.FileTransfer(true, name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			transfers = append(transfers, x)
+		}
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rng
+	pcap.WriteStandardHeader()
+
+	g := tftp.NewGenerator(pcap, uint8(*srcN), uint8(*dstN))
+	g.Rand = rng
+	for _, x := range transfers {
+		x.BlockSize = *blksize
+		if err := g.Write(x); err != nil {
+			log.Fatal(err)
+		}
+		pcap.Sleep(*pace)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{[]string{"-missing", "flag.txt", "testdata/orders.txt", "testdata/blob.bin"}, "get.pcap"},
+		{[]string{"-blksize", "1024", "-put", "testdata/blob.bin"}, "put-blksize.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, append(fixed, c.flags...)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/tls"
+	"github.com/google/gopacket/layers"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s REQUEST RESPONSE [REQUEST RESPONSE...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Runs a TLS session over TCP, sending the contents of each")
+	fmt.Fprintln(out, "REQUEST file from the client and each RESPONSE file from the server.")
+	fmt.Fprintln(out, "Use -keylog to write an SSLKEYLOGFILE that lets Wireshark decrypt it.")
+}
+
+func main() {
+	flag.Usage = usage
+	sni := flag.String("sni", "www.example.com", "Server name")
+	alpn := flag.String("alpn", "http/1.1", "Comma-separated ALPN protocols offered by the client")
+	version := flag.String("version", "1.3", "TLS version: 1.2, 1.3")
+	keylogFile := flag.String("keylog", "", "Write session secrets to this file")
+	srcN := flag.Uint("src", 11, "Value to use for client MAC address, IP address, and port")
+	dstN := flag.Uint("dst", 55, "Value to use for server MAC address and IP address")
+	port := flag.Uint("port", 443, "Server port")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 2 || len(flag.Args())%2 != 0 {
+		flag.Usage()
+		return
+	}
+
+	session := tls.Session{
+		ServerName: *sni,
+	}
+	if *alpn != "" {
+		session.ALPN = strings.Split(*alpn, ",")
+	}
+	switch *version {
+	case "1.2":
+		session.Version = tls.VersionTLS12
+	case "1.3":
+		session.Version = tls.VersionTLS13
+	default:
+		log.Fatal("Unknown TLS version:", *version)
+	}
+
+	args := flag.Args()
+	for i := 0; i < len(args); i += 2 {
+		req, err := os.ReadFile(args[i])
+		if err != nil {
+			log.Fatal(err)
+		}
+		resp, err := os.ReadFile(args[i+1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		session.Exchanges = append(session.Exchanges, tls.Exchange{Request: req, Response: resp})
+	}
+
+	if *keylogFile != "" {
+		f, err := os.Create(*keylogFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		session.KeyLog = f
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	cli, srv := pcapwriter.NewTCPv4Writers(pcap, uint8(*srcN), pcap, uint8(*dstN))
+	cli.DstPort = layers.TCPPort(*port)
+	srv.SrcPort = layers.TCPPort(*port)
+	if err := cli.Connect(); err != nil {
+		log.Fatal(err)
+	}
+	if err := session.Run(cli, srv); err != nil {
+		log.Fatal(err)
+	}
+	cli.Close()
+	srv.Close()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/xmodem"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s FILE [FILE...] > out.pcap\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Sends files with XMODEM, one transfer per file,")
+	fmt.Fprintln(out, "or with a single YMODEM batch.")
+}
+
+func main() {
+	flag.Usage = usage
+	ymodem := flag.Bool("ymodem", false, "Send all files in one YMODEM batch")
+	crc := flag.Bool("crc", false, "Use CRC-16 instead of checksums (XMODEM-CRC)")
+	oneK := flag.Bool("1k", false, "Use 1024-byte blocks (XMODEM-1K)")
+	garble := flag.String("garble", "", "Comma-separated block numbers to garble and resend")
+	transport := flag.String("transport", "udp", "Carry bytes over: udp, icmp, tcp")
+	srcN := flag.Uint("src", 11, "Value to use for sender MAC address, IP address, and port")
+	dstN := flag.Uint("dst", 55, "Value to use for receiver MAC address, IP address, and port")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	flag.Parse()
+	if len(flag.Args()) < 1 {
+		flag.Usage()
+		return
+	}
+
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := &xmodem.Session{CRC: *crc, OneK: *oneK}
+	if *garble != "" {
+		for _, v := range strings.Split(*garble, ",") {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.Garble = append(s.Garble, n)
+		}
+	}
+
+	var files []xmodem.File
+	for _, name := range flag.Args() {
+		f, err := xmodem.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Modification times would make output depend on the checkout
+		f.ModTime = begin.Add(-24 * time.Hour).Truncate(time.Second)
+		files = append(files, f)
+	}
+
+	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
+	pcap.WriteStandardHeader()
+
+	var conv *pcapwriter.Conversation
+	switch *transport {
+	case "udp":
+		conv = pcapwriter.NewUDPv4Conversation(pcap, uint8(*srcN), uint8(*dstN))
+	case "icmp":
+		conv = pcapwriter.NewICMPv4Conversation(pcap, uint8(*srcN), uint8(*dstN))
+	case "tcp":
+		conv = pcapwriter.NewTCPv4Conversation(pcap, uint8(*srcN), uint8(*dstN))
+	default:
+		log.Fatal("Unknown transport:", *transport)
+	}
+
+	if *ymodem {
+		err = s.YMODEM(conv.Client(), conv.Server(), files)
+	} else {
+		for _, f := range files {
+			if err = s.XMODEM(conv.Client(), conv.Server(), f.Data); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
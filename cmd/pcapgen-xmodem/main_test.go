@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		flags  []string
+		golden string
+	}{
+		{[]string{"-garble", "1", "testdata/orders.txt"}, "xmodem.pcap"},
+		{[]string{"-crc", "-1k", "-transport", "tcp", "testdata/blob.bin"}, "xmodem-1k.pcap"},
+		{[]string{"-ymodem", "testdata/orders.txt", "testdata/blob.bin"}, "ymodem.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			got := golden.Run(t, nil, append(fixed, c.flags...)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
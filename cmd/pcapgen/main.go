@@ -7,26 +7,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"net"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"git.cyberfire.ninja/devs/pcapgen/pkg/answerkey"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/noise"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/payload"
 	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
 )
 
-func sink(r io.Reader, wg *sync.WaitGroup) {
-	defer wg.Done()
-	buf := make([]byte, 4096)
-	for {
-		if _, err := r.Read(buf); (err == io.EOF) || (err == io.ErrClosedPipe) {
-			return
-		} else if err != nil {
-			log.Println("Read error:", err)
-		}
-	}
-}
-
 func usage() {
 	out := flag.CommandLine.Output()
 	fmt.Fprintf(out, "Usage: cat script.txt | %s > out.pcap\n", os.Args[0])
@@ -43,6 +36,38 @@ func usage() {
 	fmt.Fprintln(out, "# Server response (2 bytes + 1 byte)")
 	fmt.Fprintln(out, "S: 7f c3")
 	fmt.Fprintln(out, "S: 04")
+	fmt.Fprintln(out, "# Drop the next frame, and hold the one after for 2 frames")
+	fmt.Fprintln(out, "drop: 1")
+	fmt.Fprintln(out, "defer: 2")
+	fmt.Fprintln(out, "# Client sends 3 templated messages: counter, length, payload, CRC")
+	fmt.Fprintln(out, "repeat: 3")
+	fmt.Fprintln(out, `CT: {{$b := cat (counter "n" | u16be) "hi"}}{{len $b | u8}}{{$b}}{{crc32 $b | u32be}}`)
+	fmt.Fprintln(out, "# Server replies with \"ok\" XORed with 0x5a")
+	fmt.Fprintln(out, `ST: {{xor "\x5a" "ok"}}`)
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "CT: and ST: lines are Go templates, described in the payload package;")
+	fmt.Fprintln(out, "repeat: sends the next C, S, CT, or ST line that many times.")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "With -timing, frame timestamps carry a secret instead,")
+	fmt.Fprintln(out, "one symbol per gap, until the secret runs out.")
+	fmt.Fprintln(out, "Until then, sleep: lines are ignored, since they would garble the gaps.")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "-vlan, -mpls, and -pppoe wrap every frame in extra layers,")
+	fmt.Fprintln(out, "as seen on a trunk link or carrier network.")
+	fmt.Fprintln(out, "With -tunnel, each tunnel n deep runs between 10.n.src.src and 10.n.dst.dst.")
+}
+
+// parseNumbers parses a comma-separated list of numbers
+func parseNumbers(s string, bits int) []uint64 {
+	var ret []uint64
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(v, 10, bits)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ret = append(ret, n)
+	}
+	return ret
 }
 
 func main() {
@@ -50,26 +75,129 @@ func main() {
 	useIcmp := flag.Bool("imcp", false, "Use ICMP instead of UDP")
 	srcN := flag.Uint("src", 11, "Value to use for src MAC address, IP address, and port")
 	dstN := flag.Uint("dst", 55, "Value to use for dst MAC address, IP address, and port")
+	keyFile := flag.String("key", "", "Write a JSON answer key to this file")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed for jitter, noise, and template payloads")
+	start := flag.String("start", "2010-02-22T22:57:23.071877Z", "Timestamp of the first frame (RFC 3339)")
+	noiseMix := flag.String("noise", "", "Mix background traffic in, e.g. dns=40,https=30,ntp=10,ping=20")
+	noiseRate := flag.Duration("noise-rate", 2*time.Second, "Mean time between background exchanges")
+	noiseDuration := flag.Duration("noise-duration", 0, "Keep background traffic going this long after the first frame")
+	timingFile := flag.String("timing", "", "Hide the contents of this file in the gaps between frames")
+	timingGaps := flag.String("gaps", "100ms,300ms", "Comma-separated gap for each timing symbol; a power of 2 of them")
+	vlans := flag.String("vlan", "", "Comma-separated VLAN IDs, outermost first; more than one is QinQ")
+	labels := flag.String("mpls", "", "Comma-separated MPLS labels, outermost first")
+	pppoe := flag.Uint("pppoe", 0, "Carry frames in this PPPoE session")
+	tunnels := flag.String("tunnel", "", "Comma-separated tunnels to bury the conversation in, outermost first: gre, vxlan, ipip, gtp")
 	flag.Parse()
 
-	begin := time.Date(2010, 2, 22, 22, 57, 23, 71877000, time.UTC)
+	begin, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatal(err)
+	}
 	pcap, err := pcapwriter.NewWriter(os.Stdout, begin, 20*time.Millisecond)
 	if err != nil {
 		log.Fatal(err)
 	}
+	pcap.Rand = rand.New(rand.NewSource(*seed))
 	pcap.WriteStandardHeader()
 
-	var cli, srv io.ReadWriteCloser
+	var out io.Writer = pcap
+	var bg *noise.Noise
+	if *noiseMix != "" {
+		mix, err := noise.ParseMix(*noiseMix)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bg = noise.New(pcap, pcap, mix)
+		bg.Rate = *noiseRate
+		bg.Rand = rand.New(rand.NewSource(pcapwriter.SubSeed(*seed, "noise")))
+		if *noiseDuration > 0 {
+			bg.End = begin.Add(*noiseDuration)
+		}
+		out = bg
+	}
+
+	var tc *pcapwriter.TimingChannel
+	if *timingFile != "" {
+		secret, err := os.ReadFile(*timingFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var gaps []time.Duration
+		for _, v := range strings.Split(*timingGaps, ",") {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			gaps = append(gaps, d)
+		}
+		tc, err = pcapwriter.NewTimingChannel(out, pcap, secret, gaps...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if n := tc.Remaining(); n > 0 {
+				log.Printf("Script too short: timing channel needed %d more frames", n)
+			}
+		}()
+		out = tc
+	}
+
+	janky := pcapwriter.NewJankyWriter(pcapwriter.NopCloser{Writer: out})
+	key := answerkey.New(pcap, janky)
+
+	var encap pcapwriter.Encapsulation
+	if *vlans != "" {
+		for _, n := range parseNumbers(*vlans, 12) {
+			encap.VLANs = append(encap.VLANs, uint16(n))
+		}
+	}
+	if *labels != "" {
+		for _, n := range parseNumbers(*labels, 20) {
+			encap.MPLS = append(encap.MPLS, uint32(n))
+		}
+	}
+	encap.PPPoE = uint16(*pppoe)
+
+	// The outermost frames get the encapsulation
+	var wA, wB io.Writer = janky, janky
+	if *tunnels != "" {
+		for i, name := range strings.Split(*tunnels, ",") {
+			kind, err := pcapwriter.ParseTunnelKind(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			a, b := pcapwriter.NewTunnels(wA, uint8(*srcN), wB, uint8(*dstN), kind)
+			a.SrcIP, a.DstIP = net.IPv4(10, byte(i+1), byte(*srcN), byte(*srcN)), net.IPv4(10, byte(i+1), byte(*dstN), byte(*dstN))
+			b.SrcIP, b.DstIP = a.DstIP, a.SrcIP
+			a.ID, b.ID = uint32(i+1), uint32(i+1)
+			if i == 0 {
+				a.Encapsulation, b.Encapsulation = encap, encap
+			}
+			wA, wB = a, b
+		}
+		encap = pcapwriter.Encapsulation{}
+	}
+
+	var conv *pcapwriter.Conversation
 	if *useIcmp {
-		cli, srv = pcapwriter.NewICMPv4Taps(pcap, uint8(*srcN), uint8(*dstN))
+		cookedA, cookedB := pcapwriter.NewICMPv4Writers(wA, uint8(*srcN), wB, uint8(*dstN))
+		cookedA.Encapsulation, cookedB.Encapsulation = encap, encap
+		client, server := answerkey.Endpoints(&cookedA.IPv4Base)
+		rec := key.NewConversation("icmp", client, server)
+		conv = pcapwriter.NewConversation(rec.ClientWriter(cookedA), rec.ServerWriter(cookedB))
 	} else {
-		cli, srv = pcapwriter.NewUDPv4Taps(pcap, uint8(*srcN), uint8(*dstN))
+		cookedA, cookedB := pcapwriter.NewUDPv4Writers(wA, uint8(*srcN), wB, uint8(*dstN))
+		cookedA.Encapsulation, cookedB.Encapsulation = encap, encap
+		client, server := answerkey.Endpoints(&cookedA.IPv4Base)
+		client.Port = int(cookedA.SrcPort)
+		server.Port = int(cookedA.DstPort)
+		rec := key.NewConversation("udp", client, server)
+		conv = pcapwriter.NewConversation(rec.ClientWriter(cookedA), rec.ServerWriter(cookedB))
 	}
-
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
-	go sink(srv, wg)
-	go sink(cli, wg)
+	cli, srv := conv.Client(), conv.Server()
+	templates := payload.New(rand.New(rand.NewSource(pcapwriter.SubSeed(*seed, "payload"))))
+	// Set by a repeat: line, for the payload line right after it
+	repeat := 0
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
@@ -87,6 +215,29 @@ func main() {
 		if !found {
 			log.Fatal("line")
 		}
+		times := 1
+		if repeat > 0 {
+			switch directive {
+			case "C", "S", "CT", "ST":
+				times, repeat = repeat, 0
+			default:
+				log.Fatalf("repeat: must be followed by a C, S, CT, or ST line, not %s", directive)
+			}
+		}
+		if directive == "CT" || directive == "ST" {
+			w := cli
+			if directive == "ST" {
+				w = srv
+			}
+			for i := 0; i < times; i++ {
+				if buf, err := templates.Render(strings.TrimSpace(data)); err != nil {
+					log.Fatal(err)
+				} else {
+					w.Write(buf)
+				}
+			}
+			continue
+		}
 		data = strings.ReplaceAll(data, " ", "")
 		data = strings.ReplaceAll(data, "\t", "")
 		switch directive {
@@ -94,27 +245,65 @@ func main() {
 			if buf, err := hex.DecodeString(data); err != nil {
 				log.Fatal(err)
 			} else {
-				cli.Write(buf)
+				for i := 0; i < times; i++ {
+					cli.Write(buf)
+				}
 			}
 		case "S":
 			if buf, err := hex.DecodeString(data); err != nil {
 				log.Fatal(err)
 			} else {
-				srv.Write(buf)
+				for i := 0; i < times; i++ {
+					srv.Write(buf)
+				}
+			}
+		case "repeat":
+			if n, err := strconv.Atoi(data); err != nil {
+				log.Fatal(err)
+			} else if n < 1 {
+				log.Fatalf("repeat: %d: must be at least 1", n)
+			} else {
+				repeat = n
 			}
 		case "sleep":
 			if d, err := time.ParseDuration(data); err != nil {
 				log.Fatal(err)
+			} else if tc != nil && tc.Remaining() > 0 {
+				log.Printf("Ignoring sleep: %s while the timing channel sends its secret", data)
 			} else {
 				pcap.Sleep(d)
 			}
+		case "drop":
+			if n, err := strconv.Atoi(data); err != nil {
+				log.Fatal(err)
+			} else {
+				janky.Drop(n)
+			}
+		case "defer":
+			if n, err := strconv.Atoi(data); err != nil {
+				log.Fatal(err)
+			} else {
+				janky.Defer(n)
+			}
 		default:
 			log.Fatal("Unknown directive:", directive)
 		}
 	}
 
-	cli.Close()
-	srv.Close()
+	if repeat > 0 {
+		log.Fatal("repeat: at the end of the script, with nothing to repeat")
+	}
 
-	wg.Wait()
+	janky.Close()
+	if bg != nil {
+		if err := bg.Finish(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *keyFile != "" {
+		if err := key.WriteFile(*keyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
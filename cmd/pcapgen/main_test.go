@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/internal/golden"
+)
+
+func TestMain(m *testing.M) {
+	golden.Main(m, main)
+}
+
+func TestGolden(t *testing.T) {
+	fixed := []string{"-seed", "1", "-start", "2010-02-22T22:57:23.071877Z"}
+	cases := []struct {
+		script string
+		flags  []string
+		golden string
+	}{
+		{"simple.txt", nil, "simple-udp.pcap"},
+		{"simple.txt", []string{"-imcp"}, "simple-icmp.pcap"},
+		{"janky.txt", []string{"-src", "1", "-dst", "2"}, "janky-udp.pcap"},
+		{"simple.txt", []string{"-noise", "dns=40,https=30,ntp=10,ping=20", "-noise-duration", "30s"}, "simple-noise.pcap"},
+		{"simple.txt", []string{"-vlan", "100,20"}, "simple-qinq.pcap"},
+		{"simple.txt", []string{"-vlan", "7", "-mpls", "16,3000"}, "simple-mpls.pcap"},
+		{"simple.txt", []string{"-pppoe", "4660"}, "simple-pppoe.pcap"},
+		{"simple.txt", []string{"-tunnel", "vxlan,gre", "-vlan", "12"}, "simple-tunnel.pcap"},
+		{"simple.txt", []string{"-tunnel", "gtp,ipip", "-imcp"}, "simple-gtp.pcap"},
+		{"template.txt", nil, "template.pcap"},
+		{"timing.txt", []string{"-timing", "testdata/secret.txt", "-gaps", "1s,2s,3s,4s"}, "timing.pcap"},
+	}
+	for _, c := range cases {
+		t.Run(c.golden, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", c.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got := golden.Run(t, f, append(fixed, c.flags...)...)
+			golden.Check(t, c.golden, got)
+		})
+	}
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/google/gopacket v1.1.19
 	golang.org/x/net v0.16.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
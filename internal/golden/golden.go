@@ -0,0 +1,77 @@
+// Package golden compares command output against checked-in golden files.
+//
+// Commands are tested by running the test binary itself as the command:
+// the package's TestMain calls Main, and tests call Run.
+//
+// Run "go test ./cmd/... -update" to rewrite the golden files.
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const envVar = "PCAPGEN_GOLDEN_MAIN"
+
+var update = flag.Bool("update", false, "Rewrite golden files instead of comparing against them")
+
+// Main runs the command's main instead of the tests,
+// when the test binary was started by Run.
+func Main(m *testing.M, main func()) {
+	if os.Getenv(envVar) != "" {
+		// Forget the test flags, so main sees only its own
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Run runs the command with args, feeding it stdin, and returns its standard output.
+func Run(t *testing.T, stdin io.Reader, args ...string) []byte {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), envVar+"=1")
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stderr.String())
+	}
+	return stdout.Bytes()
+}
+
+// Check compares got against the golden file testdata/name.
+//
+// With -update, the golden file is rewritten instead.
+func Check(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output differs from golden file (%d bytes, wanted %d); run with -update if this is intended",
+			path, len(got), len(want))
+	}
+}
@@ -0,0 +1,208 @@
+// Package answerkey records what was hidden in a generated capture,
+// so puzzles can be checked for solvability and answers can be scored.
+package answerkey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+// Key describes every conversation in a capture.
+type Key struct {
+	Conversations []*Conversation `json:"conversations"`
+
+	pcap  *pcapwriter.Writer
+	janky *pcapwriter.JankyWriter
+
+	// Deferred messages waiting for a frame, by write index
+	deferred map[int]pending
+}
+
+// pending is a deferred message in a conversation
+type pending struct {
+	conv  *Conversation
+	index int
+}
+
+// Endpoint identifies one side of a conversation.
+type Endpoint struct {
+	MAC  string `json:"mac"`
+	IP   string `json:"ip"`
+	Port int    `json:"port,omitempty"`
+}
+
+// Message is a single write by one side of a conversation.
+type Message struct {
+	// Wireshark frame number, or 0 if the message was dropped.
+	// Deferred messages get their frame when they finally go out.
+	Frame int `json:"frame"`
+
+	// "client" or "server"
+	From string `json:"from"`
+
+	// Hex-encoded payload, after any decoding
+	Plaintext string `json:"plaintext"`
+
+	// Drop or deferral applied to this message
+	Impairment *pcapwriter.Impairment `json:"impairment,omitempty"`
+}
+
+// File is a file transferred within a conversation.
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Session int    `json:"session"`
+}
+
+// Conversation describes one two-party flow.
+type Conversation struct {
+	Protocol string    `json:"protocol"`
+	Client   Endpoint  `json:"client"`
+	Server   Endpoint  `json:"server"`
+	Messages []Message `json:"messages"`
+	Files    []File    `json:"files,omitempty"`
+
+	// Decode, if set, converts wire payloads to plaintext
+	Decode func([]byte) []byte `json:"-"`
+
+	key *Key
+}
+
+// New returns a Key which takes frame numbers from pcap.
+//
+// If janky is not nil, it must sit between the conversation writers and pcap,
+// and its impairments are recorded with each message.
+// New sets janky.Flushed, to number deferred messages.
+func New(pcap *pcapwriter.Writer, janky *pcapwriter.JankyWriter) *Key {
+	k := &Key{
+		pcap:     pcap,
+		janky:    janky,
+		deferred: make(map[int]pending),
+	}
+	if janky != nil {
+		janky.Flushed = k.flushed
+	}
+	return k
+}
+
+// flushed numbers a deferred message, now it's been written
+func (k *Key) flushed(i pcapwriter.Impairment) {
+	if p, ok := k.deferred[i.Write]; ok {
+		p.conv.Messages[p.index].Frame = k.pcap.Frames
+		delete(k.deferred, i.Write)
+	}
+}
+
+// Endpoints returns the client and server endpoints of the client-side base b.
+func Endpoints(b *pcapwriter.IPv4Base) (Endpoint, Endpoint) {
+	src := Endpoint{MAC: b.SrcMAC.String(), IP: b.SrcIP.String()}
+	dst := Endpoint{MAC: b.DstMAC.String(), IP: b.DstIP.String()}
+	return src, dst
+}
+
+// NewConversation adds a new conversation to the key
+func (k *Key) NewConversation(protocol string, client, server Endpoint) *Conversation {
+	c := &Conversation{
+		Protocol: protocol,
+		Client:   client,
+		Server:   server,
+		Messages: []Message{},
+		key:      k,
+	}
+	k.Conversations = append(k.Conversations, c)
+	return c
+}
+
+// WriteTo writes k as indented JSON
+func (k *Key) WriteTo(w io.Writer) (int64, error) {
+	buf, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	buf = append(buf, '\n')
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// WriteFile writes k as indented JSON to the file called name
+func (k *Key) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := k.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ClientWriter wraps w, recording every write as a client message.
+func (c *Conversation) ClientWriter(w io.Writer) io.Writer {
+	return &recorder{Writer: w, conv: c, from: "client"}
+}
+
+// ServerWriter wraps w, recording every write as a server message.
+func (c *Conversation) ServerWriter(w io.Writer) io.Writer {
+	return &recorder{Writer: w, conv: c, from: "server"}
+}
+
+// AddFile records a file transferred in session, hashing the contents of r.
+func (c *Conversation) AddFile(session int, name string, r io.Reader) error {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	c.Files = append(c.Files, File{
+		Name:    name,
+		Size:    n,
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		Session: session,
+	})
+	return nil
+}
+
+type recorder struct {
+	io.Writer
+	conv *Conversation
+	from string
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	key := r.conv.key
+	before := key.pcap.Frames
+	n, err := r.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	plaintext := p
+	if r.conv.Decode != nil {
+		plaintext = r.conv.Decode(p)
+	}
+	msg := Message{
+		From:      r.from,
+		Plaintext: hex.EncodeToString(plaintext),
+	}
+	if key.janky != nil {
+		if i := key.janky.Impaired(); i != nil {
+			imp := *i
+			msg.Impairment = &imp
+		}
+	}
+	switch {
+	case msg.Impairment == nil && key.pcap.Frames > before:
+		msg.Frame = key.pcap.Frames
+	case msg.Impairment != nil && msg.Impairment.Kind == "defer":
+		key.deferred[msg.Impairment.Write] = pending{r.conv, len(r.conv.Messages)}
+	}
+	r.conv.Messages = append(r.conv.Messages, msg)
+	return n, err
+}
@@ -0,0 +1,91 @@
+package answerkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+func TestRecord(t *testing.T) {
+	pcap, err := pcapwriter.NewWriter(new(bytes.Buffer), time.Unix(1, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	janky := pcapwriter.NewJankyWriter(pcapwriter.NopCloser{Writer: pcap})
+	key := New(pcap, janky)
+
+	a, b := pcapwriter.NewUDPv4Writers(janky, 0x01, janky, 0x40)
+	client, server := Endpoints(&a.IPv4Base)
+	conv := key.NewConversation("udp", client, server)
+	cli := conv.ClientWriter(a)
+	srv := conv.ServerWriter(b)
+
+	fmt.Fprint(cli, "alpha")
+	janky.Drop(1)
+	fmt.Fprint(srv, "beta")
+	fmt.Fprint(srv, "gamma")
+	janky.Defer(1)
+	fmt.Fprint(cli, "delta")
+	fmt.Fprint(srv, "epsilon")
+	if err := janky.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if conv.Server.IP != "192.168.64.64" {
+		t.Error("wrong server IP:", conv.Server.IP)
+	}
+	if len(conv.Messages) != 5 {
+		t.Fatal("wrong number of messages:", len(conv.Messages))
+	}
+	for i, want := range []Message{
+		{Frame: 1, From: "client", Plaintext: "616c706861"},
+		{Frame: 0, From: "server", Plaintext: "62657461"},
+		{Frame: 2, From: "server", Plaintext: "67616d6d61"},
+		{Frame: 4, From: "client", Plaintext: "64656c7461"},
+		{Frame: 3, From: "server", Plaintext: "657073696c6f6e"},
+	} {
+		got := conv.Messages[i]
+		if got.Frame != want.Frame || got.From != want.From || got.Plaintext != want.Plaintext {
+			t.Errorf("message %d: wanted %v, got %v", i, want, got)
+		}
+	}
+	if imp := conv.Messages[1].Impairment; imp == nil || imp.Kind != "drop" {
+		t.Error("drop not recorded:", imp)
+	}
+	if imp := conv.Messages[3].Impairment; imp == nil || imp.Kind != "defer" {
+		t.Error("deferral not recorded:", imp)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	pcap, err := pcapwriter.NewWriter(new(bytes.Buffer), time.Unix(1, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := New(pcap, nil)
+	conv := key.NewConversation("icmp", Endpoint{}, Endpoint{})
+	if err := conv.AddFile(3, "moo.txt", strings.NewReader("moo")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := key.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Key
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	f := decoded.Conversations[0].Files[0]
+	if f.Session != 3 || f.Size != 3 {
+		t.Error("wrong file:", f)
+	}
+	if f.SHA256 != "47dfae9288abf3d5d2252abfb0bd6ac9662637d646e6df9d5d274bc336e27abc" {
+		t.Error("wrong hash:", f.SHA256)
+	}
+}
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// frameLog keeps every frame written to it
+type frameLog struct {
+	frames [][]byte
+}
+
+func (l *frameLog) Write(p []byte) (int, error) {
+	l.frames = append(l.frames, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func decode(t *testing.T, frame []byte) *layers.DNS {
+	t.Helper()
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	if err := packet.ErrorLayer(); err != nil {
+		t.Fatal(err.Error())
+	}
+	dns, ok := packet.Layer(layers.LayerTypeDNS).(*layers.DNS)
+	if !ok {
+		t.Fatal("no DNS layer")
+	}
+	return dns
+}
+
+func TestCompression(t *testing.T) {
+	answers := []Record{
+		{Name: "www.example.com", Type: TypeCNAME, TTL: 300, Data: "web.example.com"},
+		{Name: "web.example.com", Type: TypeA, TTL: 300, Data: "10.0.0.1"},
+	}
+	buf, err := Response(1, "www.example.com", TypeA, RcodeSuccess, answers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "example" should only be spelled out once
+	if n := bytes.Count(buf, []byte("example")); n != 1 {
+		t.Errorf("example appears %d times", n)
+	}
+	// The answer's owner name is a pointer to the question at offset 12
+	if !bytes.Contains(buf, []byte{0xc0, 12, 0, byte(TypeCNAME)}) {
+		t.Errorf("no pointer to question name: %x", buf)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	l := new(frameLog)
+	g := NewGenerator(l, 0x01, 0x35)
+
+	exchanges := []Exchange{
+		{
+			Name: "www.example.com",
+			Type: TypeA,
+			Answers: []Record{
+				{Name: "www.example.com", Type: TypeCNAME, TTL: 60, Data: "example.com"},
+				{Name: "example.com", Type: TypeA, TTL: 60, Data: "93.184.216.34"},
+			},
+		},
+		{
+			Name:    "example.com",
+			Type:    TypeAAAA,
+			Answers: []Record{{Name: "example.com", Type: TypeAAAA, TTL: 60, Data: "2606:2800:220:1::"}},
+		},
+		{
+			Name:    "example.com",
+			Type:    TypeMX,
+			Answers: []Record{{Name: "example.com", Type: TypeMX, TTL: 60, Data: "10 mail.example.com"}},
+		},
+		{
+			Name:    "example.com",
+			Type:    TypeTXT,
+			Answers: []Record{{Name: "example.com", Type: TypeTXT, TTL: 60, Data: string(bytes.Repeat([]byte("v"), 300))}},
+		},
+		{
+			Name:     "nope.example.com",
+			Type:     TypeA,
+			NXDomain: true,
+		},
+	}
+	for _, e := range exchanges {
+		if err := g.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(l.frames) != 2*len(exchanges) {
+		t.Fatal("wrong number of frames:", len(l.frames))
+	}
+
+	for i, e := range exchanges {
+		query := decode(t, l.frames[2*i])
+		resp := decode(t, l.frames[2*i+1])
+		if query.QR || !resp.QR {
+			t.Errorf("%d: wrong QR bits", i)
+		}
+		if query.ID != resp.ID {
+			t.Errorf("%d: transaction ID mismatch: %d != %d", i, query.ID, resp.ID)
+		}
+		if string(resp.Questions[0].Name) != e.Name {
+			t.Errorf("%d: wrong question: %s", i, resp.Questions[0].Name)
+		}
+		if e.NXDomain {
+			if resp.ResponseCode != layers.DNSResponseCodeNXDomain {
+				t.Errorf("%d: wrong rcode: %v", i, resp.ResponseCode)
+			}
+			continue
+		}
+		if len(resp.Answers) != len(e.Answers) {
+			t.Fatalf("%d: wrong number of answers: %d", i, len(resp.Answers))
+		}
+	}
+
+	if a := decode(t, l.frames[1]).Answers[1]; a.IP.String() != "93.184.216.34" || string(a.Name) != "example.com" {
+		t.Error("wrong A record:", a)
+	}
+	if a := decode(t, l.frames[1]).Answers[0]; string(a.CNAME) != "example.com" {
+		t.Error("wrong CNAME:", string(a.CNAME))
+	}
+	if a := decode(t, l.frames[3]).Answers[0]; a.IP.String() != "2606:2800:220:1::" {
+		t.Error("wrong AAAA record:", a.IP)
+	}
+	if a := decode(t, l.frames[5]).Answers[0]; string(a.MX.Name) != "mail.example.com" || a.MX.Preference != 10 {
+		t.Error("wrong MX record:", a.MX)
+	}
+	if a := decode(t, l.frames[7]).Answers[0]; len(a.TXTs) != 2 || len(a.TXTs[0]) != 255 {
+		t.Error("wrong TXT record:", len(a.TXTs))
+	}
+}
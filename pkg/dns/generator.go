@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"io"
+	"math/rand"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+// Port is the DNS server port
+const Port = 53
+
+// Exchange is one query and its response.
+type Exchange struct {
+	Name    string
+	Type    Type
+	Answers []Record
+
+	// Respond with NXDOMAIN, instead of Answers
+	NXDomain bool
+}
+
+// Generator writes DNS exchanges between a client and a server.
+type Generator struct {
+	Client *pcapwriter.UDPv4Writer
+	Server *pcapwriter.UDPv4Writer
+
+	// Source of transaction IDs and client ports;
+	// if nil, the math/rand default source is used
+	Rand *rand.Rand
+}
+
+// NewGenerator creates a Generator with a client at host number addrClient,
+// and a DNS server at addrServer.
+func NewGenerator(w io.Writer, addrClient uint8, addrServer uint8) *Generator {
+	cli, srv := pcapwriter.NewUDPv4Writers(w, addrClient, w, addrServer)
+	cli.DstPort = Port
+	srv.SrcPort = Port
+	return &Generator{
+		Client: cli,
+		Server: srv,
+	}
+}
+
+func (g *Generator) intn(n int) int {
+	return pcapwriter.Random(g.Rand).Intn(n)
+}
+
+// Write writes a query and its response.
+//
+// Each exchange gets a random transaction ID and client port,
+// like a typical stub resolver.
+func (g *Generator) Write(e Exchange) error {
+	id := uint16(g.intn(0x10000))
+	port := layers.UDPPort(1024 + g.intn(0x10000-1024))
+	g.Client.SrcPort = port
+	g.Server.DstPort = port
+
+	query, err := Query(id, e.Name, e.Type)
+	if err != nil {
+		return err
+	}
+
+	rcode := RcodeSuccess
+	answers := e.Answers
+	if e.NXDomain {
+		rcode = RcodeNXDomain
+		answers = nil
+	}
+	resp, err := Response(id, e.Name, e.Type, rcode, answers)
+	if err != nil {
+		return err
+	}
+
+	if _, err := g.Client.Write(query); err != nil {
+		return err
+	}
+	if _, err := g.Server.Write(resp); err != nil {
+		return err
+	}
+	return nil
+}
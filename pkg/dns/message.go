@@ -0,0 +1,227 @@
+// Package dns generates DNS queries and responses.
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Type is a DNS resource record type
+type Type uint16
+
+// Record types
+const (
+	TypeA     Type = 1
+	TypeCNAME Type = 5
+	TypeNULL  Type = 10
+	TypeMX    Type = 15
+	TypeTXT   Type = 16
+	TypeAAAA  Type = 28
+)
+
+// Response codes
+const (
+	RcodeSuccess  = 0
+	RcodeNXDomain = 3
+)
+
+var typeNames = map[string]Type{
+	"A":     TypeA,
+	"CNAME": TypeCNAME,
+	"NULL":  TypeNULL,
+	"MX":    TypeMX,
+	"TXT":   TypeTXT,
+	"AAAA":  TypeAAAA,
+}
+
+// ParseType returns the Type called name, like "AAAA"
+func ParseType(name string) (Type, error) {
+	if t, ok := typeNames[strings.ToUpper(name)]; ok {
+		return t, nil
+	}
+	return 0, fmt.Errorf("unknown record type: %s", name)
+}
+
+func (t Type) String() string {
+	for name, v := range typeNames {
+		if v == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+// Record is a single answer.
+//
+// Data depends on Type:
+//
+//	A, AAAA: an IP address, like "10.1.2.3"
+//	CNAME: a domain name
+//	MX: preference and domain name, like "10 mx.example.com"
+//	TXT, NULL: arbitrary bytes
+type Record struct {
+	Name string
+	Type Type
+	TTL  uint32
+	Data string
+}
+
+// builder assembles a DNS message, compressing names as it goes
+type builder struct {
+	buf   []byte
+	names map[string]int
+}
+
+func newBuilder() *builder {
+	return &builder{
+		names: make(map[string]int),
+	}
+}
+
+func (b *builder) uint16(v uint16) {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+}
+
+func (b *builder) uint32(v uint32) {
+	b.buf = binary.BigEndian.AppendUint32(b.buf, v)
+}
+
+// name appends a domain name,
+// pointing to an earlier copy of the longest suffix already in the message.
+func (b *builder) name(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	for name != "" {
+		key := strings.ToLower(name)
+		if off, ok := b.names[key]; ok {
+			b.uint16(0xc000 | uint16(off))
+			return nil
+		}
+		if len(b.buf) < 0x4000 {
+			b.names[key] = len(b.buf)
+		}
+
+		label, rest, _ := strings.Cut(name, ".")
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("bad label length %d in %q", len(label), name)
+		}
+		b.buf = append(b.buf, uint8(len(label)))
+		b.buf = append(b.buf, label...)
+		name = rest
+	}
+	b.buf = append(b.buf, 0)
+	return nil
+}
+
+func (b *builder) header(id uint16, flags uint16, qdcount, ancount int) {
+	b.uint16(id)
+	b.uint16(flags)
+	b.uint16(uint16(qdcount))
+	b.uint16(uint16(ancount))
+	b.uint16(0) // NSCOUNT
+	b.uint16(0) // ARCOUNT
+}
+
+func (b *builder) question(name string, t Type) error {
+	if err := b.name(name); err != nil {
+		return err
+	}
+	b.uint16(uint16(t))
+	b.uint16(1) // IN
+	return nil
+}
+
+func (b *builder) record(r Record) error {
+	if err := b.name(r.Name); err != nil {
+		return err
+	}
+	b.uint16(uint16(r.Type))
+	b.uint16(1) // IN
+	b.uint32(r.TTL)
+
+	// Leave room for RDLENGTH, and fill it in once we know
+	lenOff := len(b.buf)
+	b.uint16(0)
+
+	switch r.Type {
+	case TypeA, TypeAAAA:
+		ip := net.ParseIP(r.Data)
+		if ip == nil {
+			return fmt.Errorf("bad IP address: %q", r.Data)
+		}
+		if r.Type == TypeA {
+			ip = ip.To4()
+			if ip == nil {
+				return fmt.Errorf("not an IPv4 address: %q", r.Data)
+			}
+		} else {
+			ip = ip.To16()
+		}
+		b.buf = append(b.buf, ip...)
+	case TypeCNAME:
+		if err := b.name(r.Data); err != nil {
+			return err
+		}
+	case TypeMX:
+		pref, host, _ := strings.Cut(r.Data, " ")
+		n, err := strconv.ParseUint(pref, 10, 16)
+		if err != nil {
+			return fmt.Errorf("bad MX preference: %q", r.Data)
+		}
+		b.uint16(uint16(n))
+		if err := b.name(host); err != nil {
+			return err
+		}
+	case TypeTXT:
+		// TXT data is a sequence of strings of at most 255 bytes each
+		data := r.Data
+		for {
+			n := len(data)
+			if n > 255 {
+				n = 255
+			}
+			b.buf = append(b.buf, uint8(n))
+			b.buf = append(b.buf, data[:n]...)
+			data = data[n:]
+			if len(data) == 0 {
+				break
+			}
+		}
+	default:
+		b.buf = append(b.buf, r.Data...)
+	}
+
+	rdlen := len(b.buf) - lenOff - 2
+	if rdlen > 0xffff {
+		return fmt.Errorf("record data too long: %d bytes", rdlen)
+	}
+	binary.BigEndian.PutUint16(b.buf[lenOff:], uint16(rdlen))
+	return nil
+}
+
+// Query returns an encoded recursive query for name.
+func Query(id uint16, name string, t Type) ([]byte, error) {
+	b := newBuilder()
+	b.header(id, 0x0100, 1, 0) // RD
+	if err := b.question(name, t); err != nil {
+		return nil, err
+	}
+	return b.buf, nil
+}
+
+// Response returns an encoded response to a query for name.
+func Response(id uint16, name string, t Type, rcode int, answers []Record) ([]byte, error) {
+	b := newBuilder()
+	b.header(id, 0x8180|uint16(rcode&0xf), 1, len(answers)) // QR, RD, RA
+	if err := b.question(name, t); err != nil {
+		return nil, err
+	}
+	for _, r := range answers {
+		if err := b.record(r); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
@@ -0,0 +1,230 @@
+package dns
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sleeper advances a clock; *pcapwriter.Writer is one.
+type Sleeper interface {
+	Sleep(d time.Duration)
+}
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Tunnel smuggles files through DNS, like iodine or dnscat.
+//
+// Uploads go from client to server in query names:
+//
+//	<data>.<data>.u<file>-<seq>.<domain>
+//
+// Downloads go from server to client in TXT (base64) or NULL (raw) answers
+// to polling queries:
+//
+//	d<file>-<seq>.<domain>
+//
+// In both directions, sequence 0 carries the file name,
+// and the first empty chunk marks the end of the file.
+type Tunnel struct {
+	*Generator
+
+	// Domain the tunnel server is authoritative for
+	Domain string
+
+	// "base32" or "hex"
+	Encoding string
+
+	// Longest label of encoded data, at most 63
+	LabelLen int
+
+	// TypeTXT or TypeNULL
+	AnswerType Type
+
+	// Largest chunk of download data per answer
+	AnswerLen int
+
+	// Time between exchanges, applied to Clock
+	Pace  time.Duration
+	Clock Sleeper
+
+	files int
+}
+
+// NewTunnel returns a Tunnel for domain, sending exchanges through g.
+func NewTunnel(g *Generator, domain string) *Tunnel {
+	return &Tunnel{
+		Generator:  g,
+		Domain:     strings.TrimSuffix(domain, "."),
+		Encoding:   "base32",
+		LabelLen:   63,
+		AnswerType: TypeTXT,
+		AnswerLen:  180,
+	}
+}
+
+func (t *Tunnel) encode(p []byte) (string, error) {
+	switch t.Encoding {
+	case "base32":
+		return strings.ToLower(base32Encoding.EncodeToString(p)), nil
+	case "hex":
+		return hex.EncodeToString(p), nil
+	}
+	return "", fmt.Errorf("unknown tunnel encoding: %s", t.Encoding)
+}
+
+// DecodeLabels reverses the label encoding of an upload query.
+func DecodeLabels(encoding string, labels []string) ([]byte, error) {
+	s := strings.Join(labels, "")
+	switch encoding {
+	case "base32":
+		return base32Encoding.DecodeString(strings.ToUpper(s))
+	case "hex":
+		return hex.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown tunnel encoding: %s", encoding)
+}
+
+// uploadChunk returns how many bytes fit in a single query name
+func (t *Tunnel) uploadChunk(control string) (int, error) {
+	if t.LabelLen < 1 || t.LabelLen > 63 {
+		return 0, fmt.Errorf("label length must be between 1 and 63")
+	}
+
+	// 253 bytes of name, minus control label, domain, and dots
+	room := 253 - len(control) - 1 - len(t.Domain)
+	// Each label takes a dot, too
+	chars := room / (t.LabelLen + 1) * t.LabelLen
+	if extra := room%(t.LabelLen+1) - 1; extra > 0 {
+		chars += extra
+	}
+
+	var n int
+	switch t.Encoding {
+	case "base32":
+		n = chars * 5 / 8
+	case "hex":
+		n = chars / 2
+	default:
+		return 0, fmt.Errorf("unknown tunnel encoding: %s", t.Encoding)
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("domain %q leaves no room for data", t.Domain)
+	}
+	return n, nil
+}
+
+func (t *Tunnel) exchange(e Exchange) error {
+	if err := t.Write(e); err != nil {
+		return err
+	}
+	if t.Clock != nil {
+		t.Clock.Sleep(t.Pace)
+	}
+	return nil
+}
+
+func (t *Tunnel) answer(name string, data []byte) Record {
+	r := Record{
+		Name: name,
+		Type: t.AnswerType,
+		Data: string(data),
+	}
+	if t.AnswerType == TypeTXT {
+		r.Data = base64.StdEncoding.EncodeToString(data)
+	}
+	return r
+}
+
+// Upload sends the contents of r to the server, in query names.
+func (t *Tunnel) Upload(name string, r io.Reader) error {
+	file := t.files
+	t.files += 1
+
+	first := []byte(name)
+	for seq := 0; ; seq += 1 {
+		control := "u" + strconv.Itoa(file) + "-" + strconv.Itoa(seq)
+		size, err := t.uploadChunk(control)
+		if err != nil {
+			return err
+		}
+
+		var chunk []byte
+		if seq == 0 {
+			if len(first) > size {
+				return fmt.Errorf("file name too long for one query: %s", name)
+			}
+			chunk = first
+		} else {
+			chunk = make([]byte, size)
+			n, err := io.ReadFull(r, chunk)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			chunk = chunk[:n]
+		}
+
+		encoded, err := t.encode(chunk)
+		if err != nil {
+			return err
+		}
+		labels := []string{}
+		for len(encoded) > 0 {
+			n := t.LabelLen
+			if n > len(encoded) {
+				n = len(encoded)
+			}
+			labels = append(labels, encoded[:n])
+			encoded = encoded[n:]
+		}
+		labels = append(labels, control, t.Domain)
+		qname := strings.Join(labels, ".")
+
+		ack := t.answer(qname, []byte(strconv.Itoa(seq)))
+		if err := t.exchange(Exchange{Name: qname, Type: t.AnswerType, Answers: []Record{ack}}); err != nil {
+			return err
+		}
+		if seq > 0 && len(chunk) == 0 {
+			return nil
+		}
+	}
+}
+
+// Download sends the contents of r to the client, in answers to polling queries.
+func (t *Tunnel) Download(name string, r io.Reader) error {
+	file := t.files
+	t.files += 1
+
+	if t.AnswerLen < 1 || t.AnswerLen > 0xff00 {
+		return fmt.Errorf("answer length out of range: %d", t.AnswerLen)
+	}
+
+	for seq := 0; ; seq += 1 {
+		qname := "d" + strconv.Itoa(file) + "-" + strconv.Itoa(seq) + "." + t.Domain
+
+		var chunk []byte
+		if seq == 0 {
+			chunk = []byte(name)
+		} else {
+			chunk = make([]byte, t.AnswerLen)
+			n, err := io.ReadFull(r, chunk)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			chunk = chunk[:n]
+		}
+
+		answer := t.answer(qname, chunk)
+		if err := t.exchange(Exchange{Name: qname, Type: t.AnswerType, Answers: []Record{answer}}); err != nil {
+			return err
+		}
+		if seq > 0 && len(chunk) == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+type clock struct {
+	slept time.Duration
+}
+
+func (c *clock) Sleep(d time.Duration) {
+	c.slept += d
+}
+
+// recoverUploads reassembles uploaded files from query names
+func recoverUploads(t *testing.T, frames [][]byte, encoding string, domain string) map[string][]byte {
+	t.Helper()
+	names := map[string]string{}
+	files := map[string][]byte{}
+	for i := 0; i < len(frames); i += 2 {
+		qname := string(decode(t, frames[i]).Questions[0].Name)
+		if len(qname) > 253 {
+			t.Errorf("query name too long: %d", len(qname))
+		}
+		labels := strings.Split(strings.TrimSuffix(qname, "."+domain), ".")
+		control := labels[len(labels)-1]
+		file, seq, _ := strings.Cut(control[1:], "-")
+		data, err := DecodeLabels(encoding, labels[:len(labels)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq == "0" {
+			names[file] = string(data)
+		} else {
+			files[names[file]] = append(files[names[file]], data...)
+		}
+	}
+	return files
+}
+
+func TestTunnelUpload(t *testing.T) {
+	alpha := bytes.Repeat([]byte("The quick brown fox. "), 40)
+	bravo := []byte{0, 1, 2, 0xff}
+
+	for _, encoding := range []string{"base32", "hex"} {
+		l := new(frameLog)
+		c := new(clock)
+		g := NewGenerator(l, 0x01, 0x35)
+		g.Rand = rand.New(rand.NewSource(1))
+		tun := NewTunnel(g, "t.example.com")
+		tun.Encoding = encoding
+		tun.LabelLen = 50
+		tun.Pace = time.Second
+		tun.Clock = c
+
+		if err := tun.Upload("alpha.txt", bytes.NewReader(alpha)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tun.Upload("bravo.bin", bytes.NewReader(bravo)); err != nil {
+			t.Fatal(err)
+		}
+
+		files := recoverUploads(t, l.frames, encoding, "t.example.com")
+		if !bytes.Equal(files["alpha.txt"], alpha) {
+			t.Errorf("%s: alpha.txt not recovered: %q", encoding, files["alpha.txt"])
+		}
+		if !bytes.Equal(files["bravo.bin"], bravo) {
+			t.Errorf("%s: bravo.bin not recovered: %q", encoding, files["bravo.bin"])
+		}
+		if c.slept != time.Duration(len(l.frames)/2)*time.Second {
+			t.Errorf("%s: wrong pacing: %v", encoding, c.slept)
+		}
+	}
+}
+
+func TestTunnelDownload(t *testing.T) {
+	data := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 100)
+
+	for _, answerType := range []Type{TypeTXT, TypeNULL} {
+		l := new(frameLog)
+		tun := NewTunnel(NewGenerator(l, 0x01, 0x35), "t.example.com")
+		tun.AnswerType = answerType
+		tun.AnswerLen = 64
+
+		if err := tun.Download("charlie", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		var name string
+		var got []byte
+		for i := 1; i < len(l.frames); i += 2 {
+			a := decode(t, l.frames[i]).Answers[0]
+			var chunk []byte
+			if answerType == TypeTXT {
+				b, err := base64.StdEncoding.DecodeString(string(bytes.Join(a.TXTs, nil)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				chunk = b
+			} else {
+				if a.Type != layers.DNSTypeNULL {
+					t.Fatal("wrong answer type:", a.Type)
+				}
+				chunk = a.Data
+			}
+			if i == 1 {
+				name = string(chunk)
+			} else {
+				got = append(got, chunk...)
+			}
+		}
+		if name != "charlie" {
+			t.Errorf("%v: wrong name: %q", answerType, name)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%v: data not recovered: %x", answerType, got)
+		}
+	}
+}
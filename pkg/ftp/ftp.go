@@ -0,0 +1,226 @@
+// Package ftp generates FTP sessions:
+// the control connection, and a data connection for each transfer,
+// on the ports negotiated with PASV or PORT.
+package ftp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+// Well-known ports
+const (
+	ControlPort = 21
+	DataPort    = 20
+)
+
+// Transfer commands
+const (
+	RETR = "RETR"
+	STOR = "STOR"
+	LIST = "LIST"
+)
+
+// Transfer is one command using a data connection
+type Transfer struct {
+	// RETR downloads Data, STOR uploads it, LIST sends a directory listing
+	Command string
+
+	// File name; ignored by LIST
+	Name string
+
+	Data []byte
+}
+
+// FileTransfer returns a Transfer of the file called name,
+// which is sent under its base name.
+func FileTransfer(command string, name string) (Transfer, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Transfer{}, err
+	}
+	return Transfer{Command: command, Name: filepath.Base(name), Data: data}, nil
+}
+
+// Listing returns a LIST transfer, in ls -l format, of files
+func Listing(when time.Time, files ...Transfer) Transfer {
+	buf := new(strings.Builder)
+	for _, f := range files {
+		fmt.Fprintf(buf, "-rw-r--r--    1 1000     1000     %8d %s %s\r\n", len(f.Data), when.Format("Jan 02 15:04"), f.Name)
+	}
+	return Transfer{Command: LIST, Data: []byte(buf.String())}
+}
+
+// Session describes an FTP session.
+type Session struct {
+	Username string
+	Password string
+
+	// Use PASV, with the server listening for data connections.
+	// Otherwise, use PORT, with the server connecting to the client.
+	Passive bool
+
+	Transfers []Transfer
+
+	// First port the client connects from, or listens on for active data connections
+	ClientPort uint16
+
+	// First port the server listens on for passive data connections
+	PassivePort uint16
+}
+
+// hostPort formats an address as PORT and PASV do
+func hostPort(b *pcapwriter.IPv4Base, port uint16) string {
+	ip := b.SrcIP.To4()
+	return fmt.Sprintf("%d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+// control writes lines from each side of the control connection
+type control struct {
+	client *pcapwriter.TCPv4Writer
+	server *pcapwriter.TCPv4Writer
+	err    error
+}
+
+func (c *control) send(w io.Writer, format string, a ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = w.Write([]byte(fmt.Sprintf(format, a...) + "\r\n"))
+}
+
+func (c *control) c(format string, a ...interface{}) { c.send(c.client, format, a...) }
+func (c *control) s(format string, a ...interface{}) { c.send(c.server, format, a...) }
+
+// Write writes the session to w,
+// between a client at host number addrClient and a server at addrServer.
+func (s *Session) Write(w io.Writer, addrClient uint8, addrServer uint8) error {
+	clientPort := s.ClientPort
+	if clientPort == 0 {
+		clientPort = 49152
+	}
+	passivePort := s.PassivePort
+	if passivePort == 0 {
+		passivePort = 60000
+	}
+
+	cli, srv := pcapwriter.NewTCPv4Writers(w, addrClient, w, addrServer)
+	cli.SrcPort, cli.DstPort = layers.TCPPort(clientPort), ControlPort
+	srv.SrcPort, srv.DstPort = ControlPort, layers.TCPPort(clientPort)
+	clientPort += 1
+	if err := cli.Connect(); err != nil {
+		return err
+	}
+
+	c := &control{client: cli, server: srv}
+	c.s("220 (vsFTPd 3.0.3)")
+	c.c("USER %s", s.Username)
+	c.s("331 Please specify the password.")
+	c.c("PASS %s", s.Password)
+	c.s("230 Login successful.")
+	c.c("SYST")
+	c.s("215 UNIX Type: L8")
+	c.c("TYPE I")
+	c.s("200 Switching to Binary mode.")
+
+	for _, x := range s.Transfers {
+		if c.err != nil {
+			break
+		}
+
+		// The data connection, as client and server of the TCP connection
+		var dataCli, dataSrv *pcapwriter.TCPv4Writer
+		if s.Passive {
+			c.c("PASV")
+			c.s("227 Entering Passive Mode (%s).", hostPort(&srv.IPv4Base, passivePort))
+			dataCli, dataSrv = pcapwriter.NewTCPv4Writers(w, addrClient, w, addrServer)
+			dataCli.SrcPort, dataCli.DstPort = layers.TCPPort(clientPort), layers.TCPPort(passivePort)
+			dataSrv.SrcPort, dataSrv.DstPort = layers.TCPPort(passivePort), layers.TCPPort(clientPort)
+			clientPort += 1
+			passivePort += 1
+		} else {
+			c.c("PORT %s", hostPort(&cli.IPv4Base, clientPort))
+			c.s("200 PORT command successful. Consider using PASV.")
+			dataSrv, dataCli = pcapwriter.NewTCPv4Writers(w, addrServer, w, addrClient)
+			dataSrv.SrcPort, dataSrv.DstPort = DataPort, layers.TCPPort(clientPort)
+			dataCli.SrcPort, dataCli.DstPort = layers.TCPPort(clientPort), DataPort
+			clientPort += 1
+		}
+		if c.err != nil {
+			break
+		}
+
+		// Each data connection gets its own initial sequence numbers,
+		// instead of reusing the control connection's
+		dataCli.Seq += uint32(dataCli.SrcPort) << 16
+		dataSrv.Seq += uint32(dataCli.SrcPort) << 16
+
+		// In passive mode, the client connects before sending the command
+		if s.Passive {
+			if c.err = dataCli.Connect(); c.err != nil {
+				break
+			}
+		}
+
+		// sender is the side of the data connection sending Data
+		sender, receiver := dataSrv, dataCli
+		switch x.Command {
+		case RETR:
+			c.c("RETR %s", x.Name)
+			c.s("150 Opening BINARY mode data connection for %s (%d bytes).", x.Name, len(x.Data))
+		case STOR:
+			sender, receiver = dataCli, dataSrv
+			c.c("STOR %s", x.Name)
+			c.s("150 Ok to send data.")
+		case LIST:
+			c.c("LIST")
+			c.s("150 Here comes the directory listing.")
+		default:
+			return fmt.Errorf("unknown transfer command: %s", x.Command)
+		}
+		if c.err != nil {
+			break
+		}
+
+		if !s.Passive {
+			if c.err = dataSrv.Connect(); c.err != nil {
+				break
+			}
+		}
+		if len(x.Data) > 0 {
+			if _, c.err = sender.Write(x.Data); c.err != nil {
+				break
+			}
+		}
+		if c.err = sender.Close(); c.err != nil {
+			break
+		}
+		if c.err = receiver.Close(); c.err != nil {
+			break
+		}
+
+		switch x.Command {
+		case LIST:
+			c.s("226 Directory send OK.")
+		default:
+			c.s("226 Transfer complete.")
+		}
+	}
+
+	c.c("QUIT")
+	c.s("221 Goodbye.")
+	if c.err != nil {
+		return c.err
+	}
+	if err := cli.Close(); err != nil {
+		return err
+	}
+	return srv.Close()
+}
@@ -0,0 +1,120 @@
+package ftp
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// connections reassembles the payload of each TCP connection,
+// keyed by the port of whoever sent the SYN, and the other port
+type connections struct {
+	order   []string
+	streams map[string]*bytes.Buffer
+
+	// Initial sequence numbers of every SYN and SYN/ACK
+	isns []uint32
+}
+
+func (c *connections) Write(frame []byte) (int, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	key := fmt.Sprintf("%s:%d>%s:%d", ip.SrcIP, tcp.SrcPort, ip.DstIP, tcp.DstPort)
+	if c.streams == nil {
+		c.streams = make(map[string]*bytes.Buffer)
+	}
+	if _, ok := c.streams[key]; !ok {
+		c.order = append(c.order, key)
+		c.streams[key] = new(bytes.Buffer)
+	}
+	c.streams[key].Write(tcp.Payload)
+	if tcp.SYN {
+		c.isns = append(c.isns, tcp.Seq)
+	}
+	return len(frame), nil
+}
+
+var pasvRe = regexp.MustCompile(`227 Entering Passive Mode \((\d+),(\d+),(\d+),(\d+),(\d+),(\d+)\)`)
+var portRe = regexp.MustCompile(`PORT (\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// address turns an h1,h2,h3,h4,p1,p2 match into host:port
+func address(m []string) string {
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	return fmt.Sprintf("%s.%s.%s.%s:%d", m[1], m[2], m[3], m[4], p1<<8|p2)
+}
+
+func TestSession(t *testing.T) {
+	secret := Transfer{Command: RETR, Name: "secret.txt", Data: bytes.Repeat([]byte("moo\n"), 1000)}
+	upload := Transfer{Command: STOR, Name: "loot.bin", Data: []byte{0, 1, 2, 3}}
+	list := Listing(time.Date(2010, 2, 22, 0, 0, 0, 0, time.UTC), secret)
+
+	for _, passive := range []bool{true, false} {
+		c := new(connections)
+		s := &Session{
+			Username:  "anonymous",
+			Password:  "guest@",
+			Passive:   passive,
+			Transfers: []Transfer{list, secret, upload},
+		}
+		if err := s.Write(c, 0x0b, 0x37); err != nil {
+			t.Fatal(err)
+		}
+
+		commands := c.streams[c.order[0]].String()
+		replies := c.streams[c.order[1]].String()
+		if !strings.HasPrefix(replies, "220 ") || !strings.HasSuffix(replies, "221 Goodbye.\r\n") {
+			t.Errorf("passive=%v: wrong replies:\n%s", passive, replies)
+		}
+		if !strings.Contains(commands, "RETR secret.txt\r\n") || !strings.Contains(commands, "STOR loot.bin\r\n") {
+			t.Errorf("passive=%v: wrong commands:\n%s", passive, commands)
+		}
+
+		seen := make(map[uint32]bool)
+		for _, isn := range c.isns {
+			if seen[isn] {
+				t.Errorf("passive=%v: initial sequence number %#x reused", passive, isn)
+			}
+			seen[isn] = true
+		}
+
+		// Each data connection has to be on the negotiated address
+		var listeners []string
+		if passive {
+			for _, m := range pasvRe.FindAllStringSubmatch(replies, -1) {
+				listeners = append(listeners, address(m))
+			}
+		} else {
+			for _, m := range portRe.FindAllStringSubmatch(commands, -1) {
+				listeners = append(listeners, address(m))
+			}
+		}
+		if len(listeners) != 3 {
+			t.Fatalf("passive=%v: %d data connections negotiated", passive, len(listeners))
+		}
+
+		for i, x := range s.Transfers {
+			// The server sends, unless it's an upload
+			serverSends := x.Command != STOR
+			fromListener := serverSends == passive
+			var got []byte
+			for key, buf := range c.streams {
+				src, dst, _ := strings.Cut(key, ">")
+				if (fromListener && src == listeners[i]) || (!fromListener && dst == listeners[i]) {
+					got = buf.Bytes()
+				}
+			}
+			if !bytes.Equal(got, x.Data) {
+				t.Errorf("passive=%v: %s: wrong data %q", passive, x.Command, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package http generates HTTP/1.1 requests and responses.
+//
+// Messages are written to a client/server pair of writers,
+// like the ones from pcapwriter.NewTCPv4Conversation,
+// so tools like Wireshark can reassemble them and export their objects.
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Header is a single header line
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Part is one part of a multipart/form-data body
+type Part struct {
+	// Form field name
+	Name string
+
+	// File name; if empty, this is a plain form field
+	Filename    string
+	ContentType string
+	Body        []byte
+}
+
+// Body describes a message body, and how to send it.
+type Body struct {
+	Data        []byte
+	ContentType string
+
+	// Multipart form parts; if set, these replace Data
+	Parts []Part
+
+	// Compress with gzip and set Content-Encoding
+	Gzip bool
+
+	// Use chunked transfer encoding instead of Content-Length,
+	// with chunks of at most ChunkSize bytes
+	Chunked   bool
+	ChunkSize int
+}
+
+// Request describes an HTTP request
+type Request struct {
+	Method  string
+	Path    string
+	Host    string
+	Headers []Header
+	Body
+}
+
+// Response describes an HTTP response
+type Response struct {
+	Status  int
+	Reason  string
+	Headers []Header
+	Body
+}
+
+// Exchange is a request and its response
+type Exchange struct {
+	Request  Request
+	Response Response
+}
+
+// FileBody returns a Body holding the contents of the file called name,
+// with a content type guessed from its extension.
+func FileBody(name string) (Body, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Body{}, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Body{Data: data, ContentType: contentType}, nil
+}
+
+// DefaultChunkSize is used for chunked bodies that don't specify ChunkSize
+const DefaultChunkSize = 4096
+
+// noBody reports whether a response with status never has a body
+func noBody(status int) bool {
+	return status/100 == 1 || status == 204 || status == 304
+}
+
+// encode returns the headers describing b, and the body as it goes on the wire.
+//
+// For requests, status is 0.
+// For responses, method is the request's, if known.
+func (b *Body) encode(method string, status int) ([]Header, []byte, error) {
+	if noBody(status) && (len(b.Data) > 0 || len(b.Parts) > 0 || b.Gzip || b.Chunked) {
+		return nil, nil, fmt.Errorf("status %d responses have no body", status)
+	}
+
+	var headers []Header
+	data := b.Data
+	contentType := b.ContentType
+
+	if len(b.Parts) > 0 {
+		buf := new(bytes.Buffer)
+		mw := multipart.NewWriter(buf)
+		for _, p := range b.Parts {
+			h := make(textproto.MIMEHeader)
+			disposition := fmt.Sprintf("form-data; name=%q", p.Name)
+			if p.Filename != "" {
+				disposition += fmt.Sprintf("; filename=%q", p.Filename)
+			}
+			h.Set("Content-Disposition", disposition)
+			if p.ContentType != "" {
+				h.Set("Content-Type", p.ContentType)
+			} else if p.Filename != "" {
+				h.Set("Content-Type", "application/octet-stream")
+			}
+			w, err := mw.CreatePart(h)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := w.Write(p.Body); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, nil, err
+		}
+		data = buf.Bytes()
+		contentType = mw.FormDataContentType()
+	}
+
+	if contentType != "" {
+		headers = append(headers, Header{"Content-Type", contentType})
+	}
+
+	if b.Gzip {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, nil, err
+		}
+		data = buf.Bytes()
+		headers = append(headers, Header{"Content-Encoding", "gzip"})
+	}
+
+	if b.Chunked {
+		size := b.ChunkSize
+		if size <= 0 {
+			size = DefaultChunkSize
+		}
+		buf := new(bytes.Buffer)
+		for len(data) > 0 {
+			n := len(data)
+			if n > size {
+				n = size
+			}
+			fmt.Fprintf(buf, "%x\r\n", n)
+			buf.Write(data[:n])
+			buf.WriteString("\r\n")
+			data = data[n:]
+		}
+		buf.WriteString("0\r\n\r\n")
+		data = buf.Bytes()
+		headers = append(headers, Header{"Transfer-Encoding", "chunked"})
+	} else if len(data) > 0 || b.emptyLength(method, status) {
+		headers = append(headers, Header{"Content-Length", strconv.Itoa(len(data))})
+	}
+
+	return headers, data, nil
+}
+
+// emptyLength reports whether an empty body still needs Content-Length: 0
+func (b *Body) emptyLength(method string, status int) bool {
+	if status == 0 {
+		return method != "GET" && method != "HEAD"
+	}
+	return !noBody(status) && method != "HEAD"
+}
+
+func writeHead(buf *bytes.Buffer, start string, headers ...[]Header) {
+	buf.WriteString(start)
+	buf.WriteString("\r\n")
+	for _, hs := range headers {
+		for _, h := range hs {
+			fmt.Fprintf(buf, "%s: %s\r\n", h.Name, h.Value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+// Encode returns r as it goes on the wire.
+func (r *Request) Encode() ([]byte, error) {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+	path := r.Path
+	if path == "" {
+		path = "/"
+	}
+	bodyHeaders, body, err := r.Body.encode(method, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var host []Header
+	if r.Host != "" {
+		host = []Header{{"Host", r.Host}}
+	}
+	buf := new(bytes.Buffer)
+	writeHead(buf, method+" "+path+" HTTP/1.1", host, r.Headers, bodyHeaders)
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// Encode returns r as it goes on the wire.
+func (r *Response) Encode() ([]byte, error) {
+	return r.encode("")
+}
+
+// encode returns r, answering a method request, as it goes on the wire.
+func (r *Response) encode(method string) ([]byte, error) {
+	status := r.Status
+	if status == 0 {
+		status = 200
+	}
+	reason := r.Reason
+	if reason == "" {
+		reason = statusText[status]
+	}
+	bodyHeaders, body, err := r.Body.encode(method, status)
+	if err != nil {
+		return nil, err
+	}
+
+	// A HEAD response describes the body it would send, without sending it
+	if method == "HEAD" {
+		body = nil
+	}
+
+	buf := new(bytes.Buffer)
+	writeHead(buf, fmt.Sprintf("HTTP/1.1 %d %s", status, reason), r.Headers, bodyHeaders)
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+var statusText = map[int]string{
+	200: "OK",
+	201: "Created",
+	204: "No Content",
+	301: "Moved Permanently",
+	302: "Found",
+	304: "Not Modified",
+	400: "Bad Request",
+	401: "Unauthorized",
+	403: "Forbidden",
+	404: "Not Found",
+	500: "Internal Server Error",
+}
+
+// hasHeader reports whether name is in headers
+func hasHeader(headers []Header, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes exchanges over a single keep-alive connection.
+//
+// Every exchange but the last asks to keep the connection alive;
+// the last one asks to close it.
+func Write(client io.Writer, server io.Writer, exchanges []Exchange) error {
+	for i, e := range exchanges {
+		connection := Header{"Connection", "keep-alive"}
+		if i == len(exchanges)-1 {
+			connection.Value = "close"
+		}
+
+		req := e.Request
+		if !hasHeader(req.Headers, "Connection") {
+			req.Headers = append(append([]Header{}, req.Headers...), connection)
+		}
+		resp := e.Response
+		if !hasHeader(resp.Headers, "Connection") {
+			resp.Headers = append(append([]Header{}, resp.Headers...), connection)
+		}
+
+		buf, err := req.Encode()
+		if err != nil {
+			return err
+		}
+		if _, err := client.Write(buf); err != nil {
+			return err
+		}
+
+		buf, err = resp.encode(req.Method)
+		if err != nil {
+			return err
+		}
+		if _, err := server.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
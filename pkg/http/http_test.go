@@ -0,0 +1,158 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	nethttp "net/http"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// streams reassembles the TCP payload sent by each side
+type streams struct {
+	client bytes.Buffer
+	server bytes.Buffer
+}
+
+func (s *streams) Write(frame []byte) (int, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp.SrcPort == 80 {
+		s.server.Write(tcp.Payload)
+	} else {
+		s.client.Write(tcp.Payload)
+	}
+	return len(frame), nil
+}
+
+func TestExchanges(t *testing.T) {
+	page := bytes.Repeat([]byte("<p>Hello, world.</p>\n"), 500)
+	upload := []byte("secret plans")
+
+	exchanges := []Exchange{
+		{
+			Request:  Request{Method: "GET", Path: "/index.html", Host: "www.example.com"},
+			Response: Response{Body: Body{Data: page, ContentType: "text/html", Gzip: true}},
+		},
+		{
+			Request:  Request{Method: "GET", Path: "/page", Host: "www.example.com"},
+			Response: Response{Body: Body{Data: page, ContentType: "text/html", Chunked: true, ChunkSize: 1000}},
+		},
+		{
+			Request: Request{
+				Method: "POST",
+				Path:   "/upload",
+				Host:   "www.example.com",
+				Body: Body{Parts: []Part{
+					{Name: "comment", Body: []byte("hi")},
+					{Name: "file", Filename: "plans.txt", ContentType: "text/plain", Body: upload},
+				}},
+			},
+			Response: Response{Status: 204},
+		},
+	}
+
+	s := new(streams)
+	conv := pcapwriter.NewTCPv4Conversation(s, 0x01, 80)
+	if err := Write(conv.Client(), conv.Server(), exchanges); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := bufio.NewReader(&s.client)
+	resps := bufio.NewReader(&s.server)
+	for i := range exchanges {
+		req, err := nethttp.ReadRequest(reqs)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		resp, err := nethttp.ReadResponse(resps, req)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		switch i {
+		case 0:
+			if resp.Header.Get("Content-Encoding") != "gzip" {
+				t.Error("not gzipped")
+			}
+			zr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, _ := io.ReadAll(zr); !bytes.Equal(body, page) {
+				t.Error("wrong gzipped body")
+			}
+			if resp.Close {
+				t.Error("first response closes connection")
+			}
+		case 1:
+			if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+				t.Error("not chunked:", resp.TransferEncoding)
+			}
+			if body, _ := io.ReadAll(resp.Body); !bytes.Equal(body, page) {
+				t.Error("wrong chunked body")
+			}
+		case 2:
+			if err := req.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatal(err)
+			}
+			if req.FormValue("comment") != "hi" {
+				t.Error("wrong form field")
+			}
+			f, fh, err := req.FormFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, _ := io.ReadAll(f); !bytes.Equal(body, upload) || fh.Filename != "plans.txt" {
+				t.Error("wrong uploaded file")
+			}
+			if resp.StatusCode != 204 || !resp.Close {
+				t.Error("wrong final response:", resp.Status, resp.Close)
+			}
+		}
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	cases := []struct {
+		method string
+		status int
+		data   string
+		want   bool
+	}{
+		{"GET", 200, "", true},
+		{"GET", 404, "", true},
+		{"GET", 101, "", false},
+		{"GET", 204, "", false},
+		{"GET", 304, "", false},
+		{"HEAD", 200, "", false},
+		{"HEAD", 200, "moo", true},
+	}
+	for _, c := range cases {
+		resp := Response{Status: c.status, Body: Body{Data: []byte(c.data)}}
+		buf, err := resp.encode(c.method)
+		if err != nil {
+			t.Fatal(c.status, err)
+		}
+		if got := bytes.Contains(buf, []byte("Content-Length")); got != c.want {
+			t.Errorf("%s %d: wanted Content-Length %v, got %q", c.method, c.status, c.want, buf)
+		}
+		body := c.data
+		if c.method == "HEAD" {
+			body = ""
+		}
+		if !bytes.HasSuffix(buf, []byte("\r\n\r\n"+body)) {
+			t.Errorf("%s %d: wanted body %q, got %q", c.method, c.status, body, buf)
+		}
+	}
+
+	resp := Response{Status: 204, Body: Body{Data: []byte("moo")}}
+	if _, err := resp.Encode(); err == nil {
+		t.Error("204 response with a body encoded")
+	}
+}
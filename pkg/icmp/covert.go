@@ -0,0 +1,245 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Field is where a covert channel hides its data
+type Field int
+
+const (
+	// ICMP identifier, 2 bytes per request
+	Identifier Field = iota
+
+	// ICMP sequence number, 2 bytes per request
+	Sequence
+
+	// IP identification, 2 bytes per request
+	IPID
+
+	// IP time to live, 1 byte per request.
+	// Byte b goes out as TTL 255-b, so it looks like it came from a host b hops away
+	// that starts at TTL 255.
+	// Bytes over 255-MinTTL would need a TTL too small to be believable, and can't be sent.
+	TTL
+
+	// Originate timestamp of a timestamp request, 4 bytes per request
+	Timestamp
+
+	// The zero bytes padding out the Linux ping struct timeval, 8 bytes per request
+	Padding
+)
+
+// MinTTL is the smallest TTL the TTL field will use
+const MinTTL = 32
+
+var fieldNames = map[string]Field{
+	"id":        Identifier,
+	"seq":       Sequence,
+	"ipid":      IPID,
+	"ttl":       TTL,
+	"timestamp": Timestamp,
+	"padding":   Padding,
+}
+
+// ParseField returns the Field with the given name:
+// id, seq, ipid, ttl, timestamp, or padding.
+func ParseField(name string) (Field, error) {
+	f, ok := fieldNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown covert field: %q", name)
+	}
+	return f, nil
+}
+
+// Size returns how many bytes of data fit in each request
+func (f Field) Size() int {
+	switch f {
+	case TTL:
+		return 1
+	case Identifier, Sequence, IPID:
+		return 2
+	case Timestamp:
+		return 4
+	case Padding:
+		return 8
+	}
+	return 0
+}
+
+// Covert writes data hidden in otherwise ordinary pings,
+// each answered by the other side.
+type Covert struct {
+	Request *pcapwriter.ICMPv4Writer
+	Reply   *pcapwriter.ICMPv4Writer
+
+	// Where data goes
+	Field Field
+
+	// Whose ping to imitate; the Padding field always looks like Linux
+	Style Style
+
+	// Time between requests, applied to Clock.
+	// Clock also provides timestamps for payloads.
+	Interval time.Duration
+	Clock    *pcapwriter.Writer
+
+	id  uint16
+	seq uint16
+}
+
+// NewCovert creates a Covert channel from host number addrA to addrB,
+// hiding data in field.
+func NewCovert(w io.Writer, addrA uint8, addrB uint8, field Field) *Covert {
+	req, reply := pcapwriter.NewICMPv4Writers(w, addrA, w, addrB)
+	return &Covert{
+		Request:  req,
+		Reply:    reply,
+		Field:    field,
+		Interval: time.Second,
+		id:       uint16(addrA)<<8 | uint16(addrB),
+	}
+}
+
+func (c *Covert) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock.Now
+	}
+	return time.Unix(0, 0)
+}
+
+// msSinceMidnight is the ICMP timestamp format
+func msSinceMidnight(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight) / time.Millisecond)
+}
+
+// Write sends p, a few bytes per request.
+// The last request is padded out with zeros.
+func (c *Covert) Write(p []byte) (int, error) {
+	size := c.Field.Size()
+	style := c.Style
+	if c.Field == Padding {
+		style = Linux
+	}
+	if c.Field == TTL {
+		for i, b := range p {
+			if b > 255-MinTTL {
+				return 0, fmt.Errorf("byte %d (%#02x) is too big to hide in a TTL", i, b)
+			}
+		}
+	}
+
+	for off := 0; off < len(p); off += size {
+		chunk := make([]byte, size)
+		copy(chunk, p[off:])
+		c.seq += 1
+
+		req, reply := c.Request, c.Reply
+		req.TTL, reply.TTL = style.TTL(), 64
+		req.IPv4.Id += 1
+		reply.IPv4.Id += 1
+		req.ICMPv4.Id, req.ICMPv4.Seq = c.id, c.seq
+		payload := style.Payload(c.now())
+		var reqType, replyType uint8 = layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply
+
+		switch c.Field {
+		case Identifier:
+			req.ICMPv4.Id = binary.BigEndian.Uint16(chunk)
+		case Sequence:
+			req.ICMPv4.Seq = binary.BigEndian.Uint16(chunk)
+		case IPID:
+			req.IPv4.Id = binary.BigEndian.Uint16(chunk)
+		case TTL:
+			req.TTL = 255 - chunk[0]
+		case Timestamp:
+			reqType, replyType = layers.ICMPv4TypeTimestampRequest, layers.ICMPv4TypeTimestampReply
+			payload = make([]byte, 12)
+			copy(payload, chunk)
+		case Padding:
+			copy(payload[4:8], chunk[:4])
+			copy(payload[12:16], chunk[4:])
+		}
+
+		req.TypeCode = layers.CreateICMPv4TypeCode(reqType, 0)
+		if err := c.send(req, payload); err != nil {
+			return off, err
+		}
+
+		// The reply mirrors the request
+		reply.TypeCode = layers.CreateICMPv4TypeCode(replyType, 0)
+		reply.ICMPv4.Id, reply.ICMPv4.Seq = req.ICMPv4.Id, req.ICMPv4.Seq
+		if c.Field == Timestamp {
+			ms := msSinceMidnight(c.now())
+			binary.BigEndian.PutUint32(payload[4:], ms)
+			binary.BigEndian.PutUint32(payload[8:], ms)
+		}
+		if err := c.send(reply, payload); err != nil {
+			return off, err
+		}
+
+		if c.Clock != nil {
+			c.Clock.Sleep(c.Interval)
+		}
+	}
+	return len(p), nil
+}
+
+// send writes one message, leaving Seq alone
+func (c *Covert) send(w *pcapwriter.ICMPv4Writer, payload []byte) error {
+	_, err := w.WritePacket(&w.ICMPv4, gopacket.Payload(payload))
+	return err
+}
+
+// Decode recovers data hidden in field from captured frames.
+// Frames other than requests are ignored.
+func Decode(field Field, frames [][]byte) ([]byte, error) {
+	var data []byte
+	for _, frame := range frames {
+		packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+		ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok {
+			continue
+		}
+		icmp, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+		if !ok {
+			continue
+		}
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeTimestampRequest:
+		default:
+			continue
+		}
+
+		switch field {
+		case Identifier:
+			data = binary.BigEndian.AppendUint16(data, icmp.Id)
+		case Sequence:
+			data = binary.BigEndian.AppendUint16(data, icmp.Seq)
+		case IPID:
+			data = binary.BigEndian.AppendUint16(data, ip.Id)
+		case TTL:
+			data = append(data, 255-ip.TTL)
+		case Timestamp, Padding:
+			p := icmp.Payload
+			if len(p) < 4 || (field == Padding && len(p) < 16) {
+				return nil, fmt.Errorf("short payload")
+			}
+			if field == Timestamp {
+				data = append(data, p[:4]...)
+			} else {
+				data = append(data, p[4:8]...)
+				data = append(data, p[12:16]...)
+			}
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,111 @@
+package icmp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// capture records frames and their timestamps
+func capture(t *testing.T) (*pcapwriter.Writer, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	pcap, err := pcapwriter.NewWriter(buf, time.Date(2010, 2, 22, 22, 57, 23, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcap.WriteStandardHeader()
+	return pcap, buf
+}
+
+func readFrames(t *testing.T, buf *bytes.Buffer) [][]byte {
+	t.Helper()
+	r, err := pcapgo.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames [][]byte
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			return frames
+		}
+		frames = append(frames, data)
+	}
+}
+
+func TestCovert(t *testing.T) {
+	secret := []byte("flag{pings}")
+	for name, field := range fieldNames {
+		for _, style := range []Style{Linux, Windows} {
+			pcap, buf := capture(t)
+			c := NewCovert(pcap, 0x0b, 0x37, field)
+			c.Style = style
+			c.Clock = pcap
+			if _, err := c.Write(secret); err != nil {
+				t.Fatal(err)
+			}
+			frames := readFrames(t, buf)
+
+			requests := (len(secret) + field.Size() - 1) / field.Size()
+			if len(frames) != 2*requests {
+				t.Errorf("%s: wrong number of frames: %d", name, len(frames))
+			}
+			got, err := Decode(field, frames)
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			if !bytes.Equal(bytes.TrimRight(got, "\x00"), secret) {
+				t.Errorf("%s: decoded %q", name, got)
+			}
+
+			for i := 0; i+1 < len(frames); i += 2 {
+				req := gopacket.NewPacket(frames[i], layers.LayerTypeEthernet, gopacket.Default)
+				reply := gopacket.NewPacket(frames[i+1], layers.LayerTypeEthernet, gopacket.Default)
+				a := req.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+				b := reply.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+				if a.Id != b.Id || a.Seq != b.Seq {
+					t.Errorf("%s: reply doesn't mirror request", name)
+				}
+				if field != Timestamp && !bytes.Equal(a.Payload, b.Payload) {
+					t.Errorf("%s: reply payload differs", name)
+				}
+			}
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	if p := Windows.Payload(time.Time{}); string(p) != "abcdefghijklmnopqrstuvwabcdefghi" {
+		t.Errorf("wrong Windows payload: %q", p)
+	}
+	p := Linux.Payload(time.Unix(1266879443, 71877000))
+	if len(p) != 56 || p[16] != 0x10 || p[55] != 0x37 {
+		t.Errorf("wrong Linux pattern: % x", p)
+	}
+	if !bytes.Equal(p[:16], []byte{0xd3, 0x0b, 0x83, 0x4b, 0, 0, 0, 0, 0xc5, 0x18, 0x01, 0, 0, 0, 0, 0}) {
+		t.Errorf("wrong Linux timeval: % x", p[:16])
+	}
+}
+
+func TestCovertTTL(t *testing.T) {
+	pcap, buf := capture(t)
+	c := NewCovert(pcap, 0x0b, 0x37, TTL)
+	if _, err := c.Write([]byte{0, '\n', 255 - MinTTL}); err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range readFrames(t, buf) {
+		packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+		if ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ip.TTL < MinTTL {
+			t.Errorf("implausible TTL %d", ip.TTL)
+		}
+	}
+
+	if _, err := c.Write([]byte{0xff}); err == nil {
+		t.Error("no error for a byte too big for a TTL")
+	}
+}
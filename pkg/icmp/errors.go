@@ -0,0 +1,105 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Recorder passes frames through, remembering the last one,
+// so an ICMP error can quote it.
+type Recorder struct {
+	io.Writer
+	Last []byte
+}
+
+func (r *Recorder) Write(frame []byte) (int, error) {
+	r.Last = append(r.Last[:0], frame...)
+	return r.Writer.Write(frame)
+}
+
+// Quote returns what an ICMP error quotes of an Ethernet frame:
+// its IP header, and the first 8 bytes of the IP payload.
+func Quote(frame []byte) ([]byte, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok {
+		return nil, fmt.Errorf("no IPv4 header to quote")
+	}
+	payload := ip.Payload
+	if len(payload) > 8 {
+		payload = payload[:8]
+	}
+	quote := append([]byte{}, ip.Contents...)
+	return append(quote, payload...), nil
+}
+
+// ErrorWriter sends ICMP errors about frames from other hosts.
+//
+// Errors go back to whoever sent the frame, from SrcIP and SrcMAC.
+// For a router further along the path, set SrcIP to the router's address,
+// and SrcMAC to the local gateway's.
+type ErrorWriter struct {
+	pcapwriter.ICMPv4Writer
+}
+
+// NewErrorWriter creates an ErrorWriter for host number addr.
+func NewErrorWriter(w io.Writer, addr uint8) *ErrorWriter {
+	e := new(ErrorWriter)
+	e.Writer = w
+	e.PopulateBase(addr, 0)
+	e.Protocol = layers.IPProtocolICMPv4
+	return e
+}
+
+// send writes an error about frame, with rest in the second 4 bytes of the ICMP header
+func (e *ErrorWriter) send(frame []byte, typ uint8, code uint8, rest uint32) error {
+	quote, err := Quote(frame)
+	if err != nil {
+		return err
+	}
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	eth := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+
+	e.DstMAC = eth.SrcMAC
+	e.DstIP = ip.SrcIP
+	e.TypeCode = layers.CreateICMPv4TypeCode(typ, code)
+	e.ICMPv4.Id = uint16(rest >> 16)
+	e.ICMPv4.Seq = uint16(rest)
+	_, err = e.WritePacket(&e.ICMPv4, gopacket.Payload(quote))
+	// Count up after sending, so a router's first error has its starting IP ID
+	e.IPv4.Id += 1
+	return err
+}
+
+// Unreachable says frame's destination can't be reached,
+// with a code like layers.ICMPv4CodePort or layers.ICMPv4CodeHost.
+func (e *ErrorWriter) Unreachable(frame []byte, code uint8) error {
+	return e.send(frame, layers.ICMPv4TypeDestinationUnreachable, code, 0)
+}
+
+// FragmentationNeeded says frame was too big for the next hop, which has the given MTU.
+// This is what path MTU discovery listens for.
+func (e *ErrorWriter) FragmentationNeeded(frame []byte, mtu uint16) error {
+	return e.send(frame, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded, uint32(mtu))
+}
+
+// TimeExceeded says frame's TTL ran out in transit.
+func (e *ErrorWriter) TimeExceeded(frame []byte) error {
+	return e.send(frame, layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded, 0)
+}
+
+// Redirect tells frame's sender to use gateway to reach its destination.
+func (e *ErrorWriter) Redirect(frame []byte, gateway net.IP) error {
+	gw := gateway.To4()
+	if gw == nil {
+		return fmt.Errorf("not an IPv4 address: %v", gateway)
+	}
+	return e.send(frame, layers.ICMPv4TypeRedirect, layers.ICMPv4CodeHost, binary.BigEndian.Uint32(gw))
+}
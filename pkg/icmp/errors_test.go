@@ -0,0 +1,73 @@
+package icmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestErrors(t *testing.T) {
+	pcap, buf := capture(t)
+	rec := &Recorder{Writer: pcap}
+	cli, _ := pcapwriter.NewUDPv4Writers(rec, 0x0b, rec, 0x37)
+	cli.DstPort = 161
+	e := NewErrorWriter(pcap, 0x37)
+	router := NewErrorWriter(pcap, 0x01)
+	router.SrcIP = net.IPv4(10, 0, 0, 1)
+
+	cli.Write([]byte("public"))
+	e.Unreachable(rec.Last, layers.ICMPv4CodePort)
+	cli.Write(bytes.Repeat([]byte("x"), 1400))
+	router.FragmentationNeeded(rec.Last, 1280)
+	cli.TTL = 1
+	cli.Write([]byte("hop"))
+	router.TimeExceeded(rec.Last)
+	router.Redirect(rec.Last, net.IPv4(192, 168, 2, 2))
+
+	frames := readFrames(t, buf)
+	if len(frames) != 7 {
+		t.Fatal("wrong number of frames:", len(frames))
+	}
+	cases := []struct {
+		frame int
+		tc    layers.ICMPv4TypeCode
+		src   string
+		rest  [4]byte
+	}{
+		{1, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort), "192.168.55.55", [4]byte{}},
+		{3, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded), "10.0.0.1", [4]byte{0, 0, 0x05, 0x00}},
+		{5, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded), "10.0.0.1", [4]byte{}},
+		{6, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeRedirect, layers.ICMPv4CodeHost), "10.0.0.1", [4]byte{192, 168, 2, 2}},
+	}
+	for _, c := range cases {
+		offender := frames[c.frame-1]
+		if c.frame == 6 {
+			offender = frames[4]
+		}
+		packet := gopacket.NewPacket(frames[c.frame], layers.LayerTypeEthernet, gopacket.Default)
+		ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+		if icmp.TypeCode != c.tc {
+			t.Errorf("frame %d: wrong type %v", c.frame, icmp.TypeCode)
+		}
+		if ip.SrcIP.String() != c.src || ip.DstIP.String() != "192.168.11.11" {
+			t.Errorf("frame %d: wrong addresses %v -> %v", c.frame, ip.SrcIP, ip.DstIP)
+		}
+		if rest := icmp.Contents[4:8]; !bytes.Equal(rest, c.rest[:]) {
+			t.Errorf("frame %d: wrong rest of header % x", c.frame, rest)
+		}
+
+		// The quote is the offender, from its IP header on, cut off 8 bytes into the UDP header
+		if want := offender[14 : 14+20+8]; !bytes.Equal(icmp.Payload, want) {
+			t.Errorf("frame %d: wrong quote\n% x\n% x", c.frame, icmp.Payload, want)
+		}
+		quoted := gopacket.NewPacket(icmp.Payload, layers.LayerTypeIPv4, gopacket.Default)
+		if udp, ok := quoted.Layer(layers.LayerTypeUDP).(*layers.UDP); !ok || udp.DstPort != 161 {
+			t.Errorf("frame %d: quoted UDP header not decoded", c.frame)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package icmp generates ICMP traffic that looks like it came from real tools,
+// and covert channels hiding in it.
+package icmp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Style is the operating system whose ping is imitated
+type Style int
+
+const (
+	// Linux iputils ping: 56 bytes of payload,
+	// starting with a struct timeval, then 0x10, 0x11, ...
+	Linux Style = iota
+
+	// Windows ping: 32 bytes, abcdefghijklmnopqrstuvwabcdefghi
+	Windows
+)
+
+// TTL returns the initial TTL the style's operating system uses
+func (s Style) TTL() uint8 {
+	if s == Windows {
+		return 128
+	}
+	return 64
+}
+
+// Payload returns an echo request payload, as sent at t
+func (s Style) Payload(t time.Time) []byte {
+	if s == Windows {
+		p := make([]byte, 32)
+		for i := range p {
+			p[i] = 'a' + byte(i%23)
+		}
+		return p
+	}
+
+	p := make([]byte, 56)
+	binary.LittleEndian.PutUint64(p, uint64(t.Unix()))
+	binary.LittleEndian.PutUint64(p[8:], uint64(t.Nanosecond()/1000))
+	for i := 16; i < len(p); i++ {
+		p[i] = byte(i)
+	}
+	return p
+}
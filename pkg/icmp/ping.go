@@ -0,0 +1,136 @@
+package icmp
+
+import (
+	"io"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Ping writes echo requests and replies the way ping does:
+// one identifier for the whole run, sequence numbers counting up from 1,
+// and replies mirroring their requests.
+type Ping struct {
+	Request *pcapwriter.ICMPv4Writer
+	Reply   *pcapwriter.ICMPv4Writer
+
+	// Whose ping to imitate
+	Style Style
+
+	// Identifier and next sequence number
+	Id  uint16
+	Seq uint16
+
+	// Time between requests, and round trip time, applied to Clock.
+	// Clock also provides timestamps for payloads.
+	Interval time.Duration
+	RTT      time.Duration
+	Clock    *pcapwriter.Writer
+}
+
+// NewPing creates a Ping imitating style, with hosts addrA and addrB
+// given by host number.
+func NewPing(w io.Writer, addrA uint8, addrB uint8, style Style) *Ping {
+	req, reply := pcapwriter.NewICMPv4Writers(w, addrA, w, addrB)
+	p := &Ping{
+		Request:  req,
+		Reply:    reply,
+		Style:    style,
+		Seq:      1,
+		Interval: time.Second,
+		RTT:      time.Millisecond,
+	}
+	req.TTL = style.TTL()
+	if style == Windows {
+		p.Id = 1
+	} else {
+		// Linux uses the process ID
+		p.Id = uint16(addrA)<<8 | uint16(addrB)
+	}
+	return p
+}
+
+func (p *Ping) now() time.Time {
+	if p.Clock != nil {
+		return p.Clock.Now
+	}
+	return time.Unix(0, 0)
+}
+
+func (p *Ping) sleep(d time.Duration) {
+	if p.Clock != nil {
+		p.Clock.Sleep(d)
+	}
+}
+
+// request writes the next echo request, and returns its payload
+func (p *Ping) request(data []byte) ([]byte, error) {
+	if data == nil {
+		data = p.Style.Payload(p.now())
+	}
+	p.Request.TypeCode = layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0)
+	p.Request.ICMPv4.Id, p.Request.ICMPv4.Seq = p.Id, p.Seq
+	p.Request.IPv4.Id += 1
+	_, err := p.Request.WritePacket(&p.Request.ICMPv4, gopacket.Payload(data))
+	return data, err
+}
+
+// done moves on to the next request
+func (p *Ping) done(elapsed time.Duration) {
+	p.Seq += 1
+	if p.Interval > elapsed {
+		p.sleep(p.Interval - elapsed)
+	}
+}
+
+// Echo writes a request carrying data, and its reply.
+// If data is nil, the payload is the one Style's ping sends.
+func (p *Ping) Echo(data []byte) error {
+	data, err := p.request(data)
+	if err != nil {
+		return err
+	}
+	p.sleep(p.RTT)
+
+	p.Reply.TypeCode = layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0)
+	p.Reply.ICMPv4.Id, p.Reply.ICMPv4.Seq = p.Id, p.Seq
+	p.Reply.IPv4.Id += 1
+	if _, err := p.Reply.WritePacket(&p.Reply.ICMPv4, gopacket.Payload(data)); err != nil {
+		return err
+	}
+	p.done(p.RTT)
+	return nil
+}
+
+// Unanswered writes a request which gets no reply.
+func (p *Ping) Unanswered() error {
+	if _, err := p.request(nil); err != nil {
+		return err
+	}
+	p.done(0)
+	return nil
+}
+
+// Unreachable writes a request, answered by a router saying the destination
+// can't be reached, with the given code,
+// such as layers.ICMPv4CodeHost.
+// router is the router's host number.
+func (p *Ping) Unreachable(router uint8, code uint8) error {
+	rec := &Recorder{Writer: p.Request.Writer}
+	p.Request.Writer = rec
+	_, err := p.request(nil)
+	p.Request.Writer = rec.Writer
+	if err != nil {
+		return err
+	}
+	p.sleep(p.RTT)
+
+	gw := NewErrorWriter(p.Reply.Writer, router)
+	if err := gw.Unreachable(rec.Last, code); err != nil {
+		return err
+	}
+	p.done(p.RTT)
+	return nil
+}
@@ -0,0 +1,96 @@
+package icmp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestPing(t *testing.T) {
+	pcap, buf := capture(t)
+	p := NewPing(pcap, 0x0b, 0x37, Linux)
+	p.Clock = pcap
+	p.RTT = 12 * time.Millisecond
+	p.Echo(nil)
+	p.Unanswered()
+	p.Echo([]byte("custom"))
+	p.Unreachable(0x01, layers.ICMPv4CodeHost)
+
+	r, err := pcapgo.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type msg struct {
+		when time.Time
+		ip   *layers.IPv4
+		icmp *layers.ICMPv4
+	}
+	var msgs []msg
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		msgs = append(msgs, msg{
+			ci.Timestamp,
+			packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4),
+			packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4),
+		})
+	}
+	if len(msgs) != 7 {
+		t.Fatal("wrong number of frames:", len(msgs))
+	}
+
+	for i, seq := range []uint16{1, 1, 2, 3, 3, 4} {
+		if m := msgs[i].icmp; m.Seq != seq || m.Id != 0x0b37 {
+			t.Errorf("frame %d: wrong id/seq %04x/%d", i, m.Id, m.Seq)
+		}
+	}
+	if msgs[1].icmp.TypeCode.Type() != layers.ICMPv4TypeEchoReply || !bytes.Equal(msgs[0].icmp.Payload, msgs[1].icmp.Payload) {
+		t.Error("reply doesn't mirror request")
+	}
+	if d := msgs[1].when.Sub(msgs[0].when); d != 12*time.Millisecond {
+		t.Error("wrong RTT:", d)
+	}
+	if d := msgs[2].when.Sub(msgs[0].when); d != time.Second {
+		t.Error("wrong interval:", d)
+	}
+	if string(msgs[4].icmp.Payload) != "custom" {
+		t.Error("wrong custom payload")
+	}
+
+	unreach := msgs[6]
+	if unreach.icmp.TypeCode != layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeHost) {
+		t.Error("wrong type:", unreach.icmp.TypeCode)
+	}
+	if unreach.ip.SrcIP.String() != "192.168.1.1" {
+		t.Error("unreachable from wrong address:", unreach.ip.SrcIP)
+	}
+	quoted := gopacket.NewPacket(unreach.icmp.Payload, layers.LayerTypeIPv4, gopacket.Default)
+	qip, ok := quoted.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok || !qip.DstIP.Equal(msgs[5].ip.DstIP) || qip.Id != msgs[5].ip.Id {
+		t.Error("quote isn't the request")
+	}
+	if len(unreach.icmp.Payload) != 20+8 {
+		t.Error("wrong quote length:", len(unreach.icmp.Payload))
+	}
+}
+
+func TestWindowsPing(t *testing.T) {
+	pcap, buf := capture(t)
+	p := NewPing(pcap, 0x0b, 0x37, Windows)
+	p.Echo(nil)
+	frames := readFrames(t, buf)
+	packet := gopacket.NewPacket(frames[0], layers.LayerTypeEthernet, gopacket.Default)
+	if ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ip.TTL != 128 {
+		t.Error("wrong TTL:", ip.TTL)
+	}
+	if icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); icmp.Id != 1 || len(icmp.Payload) != 32 {
+		t.Error("doesn't look like Windows")
+	}
+}
@@ -0,0 +1,226 @@
+package lan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Well-known destination addresses
+var (
+	BroadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	LLDPMAC      = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+	MDNSMAC      = net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0xfb}
+	SSDPMAC      = net.HardwareAddr{0x01, 0x00, 0x5e, 0x7f, 0xff, 0xfa}
+
+	BroadcastIP = net.IPv4(255, 255, 255, 255)
+	MDNSIP      = net.IPv4(224, 0, 0, 251)
+	SSDPIP      = net.IPv4(239, 255, 255, 250)
+)
+
+// Host is a simulated machine on the segment.
+type Host struct {
+	Name string
+	MAC  net.HardwareAddr
+	IP   net.IP
+}
+
+// NewHost returns host number n, addressed as pcapwriter.IPv4Base.PopulateBase would:
+// MAC address 00:00:n:n:n:n and IP address 192.168.n.n
+func NewHost(name string, n uint8) *Host {
+	return &Host{
+		Name: name,
+		MAC:  net.HardwareAddr{0, 0, n, n, n, n},
+		IP:   net.IPv4(192, 168, n, n),
+	}
+}
+
+func serialize(l ...gopacket.SerializableLayer) ([]byte, error) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+	if err := gopacket.SerializeLayers(buf, opts, l...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func arp(op uint16, srcMAC net.HardwareAddr, srcIP net.IP, dstEth, dstMAC net.HardwareAddr, dstIP net.IP) ([]byte, error) {
+	eth := &layers.Ethernet{
+		SrcMAC:       srcMAC,
+		DstMAC:       dstEth,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	a := &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         op,
+		SourceHwAddress:   srcMAC,
+		SourceProtAddress: srcIP.To4(),
+		DstHwAddress:      dstMAC,
+		DstProtAddress:    dstIP.To4(),
+	}
+	return serialize(eth, a)
+}
+
+// ARPRequest returns a broadcast request from h, asking who has ip.
+func ARPRequest(h *Host, ip net.IP) ([]byte, error) {
+	return arp(layers.ARPRequest, h.MAC, h.IP, BroadcastMAC, net.HardwareAddr{0, 0, 0, 0, 0, 0}, ip)
+}
+
+// ARPReply returns h's reply to an ARP request from to.
+func ARPReply(h *Host, to *Host) ([]byte, error) {
+	return arp(layers.ARPReply, h.MAC, h.IP, to.MAC, to.MAC, to.IP)
+}
+
+// GratuitousARP returns a broadcast announcement of h's address.
+func GratuitousARP(h *Host) ([]byte, error) {
+	return arp(layers.ARPRequest, h.MAC, h.IP, BroadcastMAC, BroadcastMAC, h.IP)
+}
+
+// LLDP returns a Link Layer Discovery Protocol advertisement from h,
+// as a switch would send out port.
+func LLDP(h *Host, port string) ([]byte, error) {
+	eth := &layers.Ethernet{
+		SrcMAC:       h.MAC,
+		DstMAC:       LLDPMAC,
+		EthernetType: layers.EthernetTypeLinkLayerDiscovery,
+	}
+	lldp := &layers.LinkLayerDiscovery{
+		ChassisID: layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeMACAddr, ID: h.MAC},
+		PortID:    layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeIfaceName, ID: []byte(port)},
+		TTL:       120,
+		Values: []layers.LinkLayerDiscoveryValue{
+			{Type: layers.LLDPTLVSysName, Length: uint16(len(h.Name)), Value: []byte(h.Name)},
+		},
+	}
+	return serialize(eth, lldp)
+}
+
+func udp(h *Host, dstMAC net.HardwareAddr, dstIP net.IP, srcPort, dstPort uint16, ttl uint8, payload []byte) ([]byte, error) {
+	eth := &layers.Ethernet{
+		SrcMAC:       h.MAC,
+		DstMAC:       dstMAC,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      ttl,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    h.IP,
+		DstIP:    dstIP,
+	}
+	u := &layers.UDP{
+		SrcPort: layers.UDPPort(srcPort),
+		DstPort: layers.UDPPort(dstPort),
+	}
+	u.SetNetworkLayerForChecksum(ip)
+	return serialize(eth, ip, u, gopacket.Payload(payload))
+}
+
+// MDNS returns a multicast DNS announcement of h's address, as h.local.
+func MDNS(h *Host) ([]byte, error) {
+	name := strings.ToLower(h.Name) + ".local"
+	dns := &layers.DNS{
+		QR:     true,
+		OpCode: layers.DNSOpCodeQuery,
+		AA:     true,
+		Answers: []layers.DNSResourceRecord{
+			{
+				Name:  []byte(name),
+				Type:  layers.DNSTypeA,
+				Class: layers.DNSClass(0x8001), // IN, cache flush
+				TTL:   120,
+				IP:    h.IP.To4(),
+			},
+		},
+	}
+	p, err := payload(dns)
+	if err != nil {
+		return nil, err
+	}
+	return udp(h, MDNSMAC, MDNSIP, 5353, 5353, 255, p)
+}
+
+// SSDP returns a UPnP alive notification from h.
+func SSDP(h *Host) ([]byte, error) {
+	uuid := fmt.Sprintf("%08x-0000-1000-8000-%012x", binary.BigEndian.Uint32(h.IP.To4()), []byte(h.MAC))
+	msg := strings.Join([]string{
+		"NOTIFY * HTTP/1.1",
+		"HOST: 239.255.255.250:1900",
+		"CACHE-CONTROL: max-age=1800",
+		fmt.Sprintf("LOCATION: http://%s:49152/description.xml", h.IP),
+		"NT: upnp:rootdevice",
+		"NTS: ssdp:alive",
+		"SERVER: Linux/2.6 UPnP/1.0 " + h.Name + "/1.0",
+		"USN: uuid:" + uuid + "::upnp:rootdevice",
+		"", "",
+	}, "\r\n")
+	return udp(h, SSDPMAC, SSDPIP, 1900, 1900, 4, []byte(msg))
+}
+
+// dhcp returns one DHCP message between client and server.
+func dhcp(msgType layers.DHCPMsgType, xid uint32, client *Host, server *Host) ([]byte, error) {
+	d := &layers.DHCPv4{
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          xid,
+		Flags:        0x8000, // broadcast
+		ClientHWAddr: client.MAC,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(msgType)}),
+		},
+	}
+
+	lease := binary.BigEndian.AppendUint32(nil, 86400)
+	src, srcPort, dstPort := server, uint16(67), uint16(68)
+	switch msgType {
+	case layers.DHCPMsgTypeDiscover, layers.DHCPMsgTypeRequest:
+		d.Operation = layers.DHCPOpRequest
+		d.Options = append(d.Options,
+			layers.NewDHCPOption(layers.DHCPOptHostname, []byte(client.Name)),
+			layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{1, 3, 6, 15}),
+		)
+		if msgType == layers.DHCPMsgTypeRequest {
+			d.Options = append(d.Options,
+				layers.NewDHCPOption(layers.DHCPOptRequestIP, client.IP.To4()),
+				layers.NewDHCPOption(layers.DHCPOptServerID, server.IP.To4()),
+			)
+		}
+		// The client has no address yet
+		src, srcPort, dstPort = &Host{MAC: client.MAC, IP: net.IPv4zero}, 68, 67
+	default:
+		d.Operation = layers.DHCPOpReply
+		d.YourClientIP = client.IP
+		d.NextServerIP = server.IP
+		d.Options = append(d.Options,
+			layers.NewDHCPOption(layers.DHCPOptServerID, server.IP.To4()),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, lease),
+			layers.NewDHCPOption(layers.DHCPOptSubnetMask, []byte{255, 255, 0, 0}),
+			layers.NewDHCPOption(layers.DHCPOptRouter, server.IP.To4()),
+			layers.NewDHCPOption(layers.DHCPOptDNS, server.IP.To4()),
+		)
+	}
+
+	p, err := payload(d)
+	if err != nil {
+		return nil, err
+	}
+	return udp(src, BroadcastMAC, BroadcastIP, srcPort, dstPort, 64, p)
+}
+
+// payload serializes a single application layer
+func payload(l gopacket.SerializableLayer) ([]byte, error) {
+	buf := gopacket.NewSerializeBuffer()
+	if err := l.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,189 @@
+// Package lan fills in the chatter of a real LAN segment around generated
+// conversations: ARP before first contact, DHCP when hosts join, and
+// periodic announcements.
+package lan
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// timer emits a frame every so often
+type timer struct {
+	due   time.Time
+	every time.Duration
+	frame func() ([]byte, error)
+}
+
+// Segment is a LAN segment, writing frames to a pcapwriter.Writer.
+//
+// Frames written to a Segment are passed through to the Writer,
+// preceded by an ARP exchange the first time two hosts talk,
+// and by any periodic frames which came due since the last write.
+type Segment struct {
+	pcap *pcapwriter.Writer
+
+	// DHCP server and default gateway
+	Router *Host
+
+	// Source of DHCP transaction IDs and timer phases;
+	// if nil, the math/rand default source is used
+	Rand *rand.Rand
+
+	known  map[[2]string]bool
+	timers []*timer
+}
+
+// NewSegment returns a Segment writing to pcap, with router as its DHCP server.
+func NewSegment(pcap *pcapwriter.Writer, router *Host) *Segment {
+	return &Segment{
+		pcap:   pcap,
+		Router: router,
+		known:  make(map[[2]string]bool),
+	}
+}
+
+func (s *Segment) int63n(n int64) int64 {
+	return pcapwriter.Random(s.Rand).Int63n(n)
+}
+
+// emit writes a frame straight to the pcap writer
+func (s *Segment) emit(frame []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = s.pcap.Write(frame)
+	return err
+}
+
+// Every arranges for frame to be called every interval,
+// starting at a random point within the first interval,
+// and writes what it returns.
+func (s *Segment) Every(interval time.Duration, frame func() ([]byte, error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, not %v", interval)
+	}
+	t := &timer{
+		due:   s.pcap.Now.Add(time.Duration(s.int63n(int64(interval)))),
+		every: interval,
+		frame: frame,
+	}
+	s.timers = append(s.timers, t)
+	return nil
+}
+
+// Flush writes every periodic frame that has come due,
+// each with its own timestamp.
+//
+// Write calls this automatically;
+// call it at the end of a capture to fill in the tail.
+func (s *Segment) Flush() error {
+	now := s.pcap.Now
+	defer func() {
+		s.pcap.Now = now
+	}()
+
+	for len(s.timers) > 0 {
+		sort.SliceStable(s.timers, func(i, j int) bool {
+			return s.timers[i].due.Before(s.timers[j].due)
+		})
+		t := s.timers[0]
+		if t.due.After(now) {
+			break
+		}
+		s.pcap.Now = t.due
+		if err := s.emit(t.frame()); err != nil {
+			return err
+		}
+		t.due = t.due.Add(t.every)
+	}
+	return nil
+}
+
+// Contact writes an ARP exchange, with a asking for b,
+// unless a already knows b's MAC address.
+func (s *Segment) Contact(a *Host, b *Host) error {
+	if s.known[[2]string{a.IP.String(), b.IP.String()}] {
+		return nil
+	}
+	if err := s.emit(ARPRequest(a, b.IP)); err != nil {
+		return err
+	}
+	if err := s.emit(ARPReply(b, a)); err != nil {
+		return err
+	}
+	// b learned a's address from the request, too
+	s.known[[2]string{a.IP.String(), b.IP.String()}] = true
+	s.known[[2]string{b.IP.String(), a.IP.String()}] = true
+	return nil
+}
+
+// Join writes a DHCP exchange, in which h gets its address from Router,
+// followed by a gratuitous ARP.
+func (s *Segment) Join(h *Host) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	xid := uint32(s.int63n(1 << 32))
+	for _, msgType := range []layers.DHCPMsgType{
+		layers.DHCPMsgTypeDiscover,
+		layers.DHCPMsgTypeOffer,
+		layers.DHCPMsgTypeRequest,
+		layers.DHCPMsgTypeAck,
+	} {
+		if err := s.emit(dhcp(msgType, xid, h, s.Router)); err != nil {
+			return err
+		}
+	}
+	// The router now knows h, from the DHCP exchange
+	s.known[[2]string{s.Router.IP.String(), h.IP.String()}] = true
+	return s.emit(GratuitousARP(h))
+}
+
+// Write passes an Ethernet frame through to the pcap writer,
+// after any due periodic frames and any needed ARP exchange.
+func (s *Segment) Write(frame []byte) (int, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+
+	// Unicast IPv4 between hosts that haven't talked yet needs ARP first,
+	// even under VLAN tags, MPLS labels, or PPPoE
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.NoCopy)
+	eth, _ := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	ip, _ := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if eth != nil && ip != nil && eth.DstMAC[0]&1 == 0 {
+		// Copy addresses out of the caller's buffer, which it may reuse
+		src := &Host{
+			MAC: append(net.HardwareAddr(nil), eth.SrcMAC...),
+			IP:  append(net.IP(nil), ip.SrcIP.To4()...),
+		}
+		dst := &Host{
+			MAC: append(net.HardwareAddr(nil), eth.DstMAC...),
+			IP:  append(net.IP(nil), ip.DstIP.To4()...),
+		}
+		// Off-segment traffic goes through the router
+		if s.Router != nil {
+			if bytes.Equal(dst.MAC, s.Router.MAC) {
+				dst = s.Router
+			} else if bytes.Equal(src.MAC, s.Router.MAC) {
+				src = s.Router
+			}
+		}
+		if !bytes.Equal(src.MAC, dst.MAC) {
+			if err := s.Contact(src, dst); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return s.pcap.Write(frame)
+}
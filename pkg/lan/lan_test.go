@@ -0,0 +1,193 @@
+package lan
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+type frame struct {
+	when   time.Time
+	packet gopacket.Packet
+}
+
+func readFrames(t *testing.T, buf *bytes.Buffer) []frame {
+	t.Helper()
+	r, err := pcapgo.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []frame
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		if err := packet.ErrorLayer(); err != nil {
+			t.Fatal(err.Error())
+		}
+		frames = append(frames, frame{ci.Timestamp, packet})
+	}
+	return frames
+}
+
+func newSegment(t *testing.T) (*Segment, *pcapwriter.Writer, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	pcap, err := pcapwriter.NewWriter(buf, time.Unix(1000, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcap.WriteStandardHeader()
+	s := NewSegment(pcap, NewHost("router", 1))
+	s.Rand = rand.New(rand.NewSource(1))
+	return s, pcap, buf
+}
+
+func TestARPBeforeFirstContact(t *testing.T) {
+	s, _, buf := newSegment(t)
+	cli, srv := pcapwriter.NewUDPv4Writers(s, 0x0b, s, 0x37)
+
+	cli.Write([]byte("alpha"))
+	srv.Write([]byte("beta"))
+	cli.Write([]byte("gamma"))
+
+	frames := readFrames(t, buf)
+	if len(frames) != 5 {
+		t.Fatal("wrong number of frames:", len(frames))
+	}
+	req, ok := frames[0].packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || req.Operation != layers.ARPRequest {
+		t.Fatal("first frame isn't an ARP request")
+	}
+	if !bytes.Equal(req.DstProtAddress, []byte{192, 168, 0x37, 0x37}) {
+		t.Error("wrong ARP target:", req.DstProtAddress)
+	}
+	reply, ok := frames[1].packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || reply.Operation != layers.ARPReply {
+		t.Fatal("second frame isn't an ARP reply")
+	}
+	if !bytes.Equal(reply.SourceHwAddress, []byte{0, 0, 0x37, 0x37, 0x37, 0x37}) {
+		t.Error("wrong ARP answer:", reply.SourceHwAddress)
+	}
+	for _, f := range frames[2:] {
+		if f.packet.Layer(layers.LayerTypeUDP) == nil {
+			t.Error("unexpected non-UDP frame")
+		}
+	}
+}
+
+func TestARPEncapsulated(t *testing.T) {
+	cases := map[string]pcapwriter.Encapsulation{
+		"vlan":  {VLANs: []uint16{100, 20}},
+		"mpls":  {VLANs: []uint16{7}, MPLS: []uint32{16, 3000}},
+		"pppoe": {PPPoE: 0x1234},
+	}
+	for name, encap := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, pcap, _ := newSegment(t)
+			cli, _ := pcapwriter.NewUDPv4Writers(s, 0x0b, s, 0x37)
+			cli.Encapsulation = encap
+			cli.Write([]byte("alpha"))
+			cli.Write([]byte("beta"))
+			if pcap.Frames != 4 {
+				t.Error("wrong number of frames:", pcap.Frames)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	s, pcap, buf := newSegment(t)
+	laptop := NewHost("laptop", 0x20)
+	if err := s.Join(laptop); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := readFrames(t, buf)
+	if len(frames) != 5 {
+		t.Fatal("wrong number of frames:", len(frames))
+	}
+	var xid uint32
+	for i, want := range []layers.DHCPMsgType{
+		layers.DHCPMsgTypeDiscover,
+		layers.DHCPMsgTypeOffer,
+		layers.DHCPMsgTypeRequest,
+		layers.DHCPMsgTypeAck,
+	} {
+		d, ok := frames[i].packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok {
+			t.Fatalf("frame %d isn't DHCP", i)
+		}
+		if i == 0 {
+			xid = d.Xid
+		} else if d.Xid != xid {
+			t.Errorf("frame %d: wrong xid", i)
+		}
+		if got := layers.DHCPMsgType(d.Options[0].Data[0]); got != want {
+			t.Errorf("frame %d: wanted %v, got %v", i, want, got)
+		}
+	}
+	if a, ok := frames[4].packet.Layer(layers.LayerTypeARP).(*layers.ARP); !ok || !bytes.Equal(a.DstProtAddress, a.SourceProtAddress) {
+		t.Error("no gratuitous ARP after DHCP")
+	}
+
+	// The router learned the laptop's address from DHCP
+	if err := s.Contact(s.Router, laptop); err != nil {
+		t.Fatal(err)
+	}
+	if pcap.Frames != 5 {
+		t.Error("unnecessary ARP")
+	}
+}
+
+func TestPeriodic(t *testing.T) {
+	s, pcap, buf := newSegment(t)
+	printer := NewHost("printer", 0x30)
+	s.Every(10*time.Second, func() ([]byte, error) { return MDNS(printer) })
+	s.Every(30*time.Second, func() ([]byte, error) { return LLDP(s.Router, "ge-0/0/1") })
+	s.Every(60*time.Second, func() ([]byte, error) { return SSDP(printer) })
+	if err := s.Every(0, func() ([]byte, error) { return SSDP(printer) }); err == nil {
+		t.Error("zero interval accepted")
+	}
+
+	cli, _ := pcapwriter.NewUDPv4Writers(s, 0x0b, s, 0x37)
+	pcap.Sleep(95 * time.Second)
+	cli.Write([]byte("alpha"))
+	end := pcap.Now
+
+	frames := readFrames(t, buf)
+	counts := map[string]int{}
+	for i, f := range frames {
+		if i > 0 && f.when.Before(frames[i-1].when) {
+			t.Errorf("frame %d out of order", i)
+		}
+		if f.when.After(end) {
+			t.Errorf("frame %d from the future", i)
+		}
+		if f.packet.Layer(layers.LayerTypeLinkLayerDiscovery) != nil {
+			counts["lldp"] += 1
+		}
+		if udp, ok := f.packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+			counts[udp.DstPort.String()] += 1
+		}
+	}
+	if n := counts["5353(mdns)"]; n < 9 || n > 10 {
+		t.Error("wrong number of mDNS frames:", n, counts)
+	}
+	if n := counts["1900(ssdp)"]; n < 1 || n > 2 {
+		t.Error("wrong number of SSDP frames:", n, counts)
+	}
+	if n := counts["lldp"]; n < 3 || n > 4 {
+		t.Error("wrong number of LLDP frames:", n)
+	}
+	if pcap.Now != end {
+		t.Error("clock moved")
+	}
+}
@@ -0,0 +1,172 @@
+package layer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var ErrShortData = errors.New("short data")
+
+// Layer is one message of a Protocol.
+//
+// Contents are the bytes on the wire.
+// Payload is whatever follows the message, de-obfuscated.
+type Layer struct {
+	layers.BaseLayer
+	Protocol *Protocol
+
+	// Integer fields, by name
+	Values map[string]uint64
+
+	// Byte string fields, by name
+	Bytes map[string][]byte
+}
+
+func (l *Layer) LayerType() gopacket.LayerType {
+	return l.Protocol.layerType
+}
+
+func (l *Layer) CanDecode() gopacket.LayerClass {
+	return l.Protocol.layerType
+}
+
+func (l *Layer) NextLayerType() gopacket.LayerType {
+	if len(l.Payload) > 0 {
+		return gopacket.LayerTypePayload
+	}
+	return gopacket.LayerTypeZero
+}
+
+// Opcode returns the value of the opcode field
+func (l *Layer) Opcode() uint64 {
+	return l.Values[l.Protocol.Opcode]
+}
+
+// Message returns the description of l's message, or nil if the opcode is unknown
+func (l *Layer) Message() *Message {
+	return l.Protocol.Message(l.Opcode())
+}
+
+// fields returns the fields in l, in order
+func (l *Layer) fields() []Field {
+	fields := l.Protocol.Header
+	if m := l.Message(); m != nil {
+		fields = append(fields[:len(fields):len(fields)], m.Fields...)
+	}
+	return fields
+}
+
+// xor obfuscates or de-obfuscates buf in place
+func (p *Protocol) xor(buf []byte) {
+	if len(p.Key) == 0 {
+		return
+	}
+	for i := range buf {
+		buf[i] ^= p.Key[i%len(p.Key)]
+	}
+}
+
+// readFields decodes fields from plain, starting at off, and returns the new offset
+func (l *Layer) readFields(plain []byte, off int, fields []Field) (int, error) {
+	order := l.Protocol.byteOrder()
+	for _, f := range fields {
+		n := f.Size
+		if n == 0 {
+			n = len(plain) - off
+			if f.Length != "" {
+				// Compare unsigned, so huge lengths can't go negative
+				length := l.Values[f.Length]
+				if length > uint64(n) {
+					return off, fmt.Errorf("%s %s: %w", l.Protocol.Name, f.Name, ErrShortData)
+				}
+				n = int(length)
+			}
+		}
+		if off+n > len(plain) {
+			return off, fmt.Errorf("%s %s: %w", l.Protocol.Name, f.Name, ErrShortData)
+		}
+		b := plain[off : off+n]
+		switch f.Size {
+		case 0:
+			l.Bytes[f.Name] = append([]byte{}, b...)
+		case 1:
+			l.Values[f.Name] = uint64(b[0])
+		case 2:
+			l.Values[f.Name] = uint64(order.Uint16(b))
+		case 4:
+			l.Values[f.Name] = uint64(order.Uint32(b))
+		case 8:
+			l.Values[f.Name] = order.Uint64(b)
+		}
+		off += n
+	}
+	return off, nil
+}
+
+func (l *Layer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	plain := append([]byte{}, data...)
+	l.Protocol.xor(plain)
+	l.Values = make(map[string]uint64)
+	l.Bytes = make(map[string][]byte)
+
+	off, err := l.readFields(plain, 0, l.Protocol.Header)
+	if err != nil {
+		df.SetTruncated()
+		return err
+	}
+	if m := l.Message(); m != nil {
+		if off, err = l.readFields(plain, off, m.Fields); err != nil {
+			df.SetTruncated()
+			return err
+		}
+	}
+	l.Contents = data[:off]
+	l.Payload = plain[off:]
+	return nil
+}
+
+func (l *Layer) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	fields := l.fields()
+	if opts.FixLengths {
+		for _, f := range fields {
+			if f.Size == 0 && f.Length != "" {
+				l.Values[f.Length] = uint64(len(l.Bytes[f.Name]))
+			}
+		}
+	}
+
+	var buf []byte
+	order := l.Protocol.byteOrder()
+	for _, f := range fields {
+		v := l.Values[f.Name]
+		switch f.Size {
+		case 0:
+			data := l.Bytes[f.Name]
+			if f.Length != "" && uint64(len(data)) != l.Values[f.Length] {
+				return fmt.Errorf("%s %s: %d bytes, but %s is %d", l.Protocol.Name, f.Name, len(data), f.Length, l.Values[f.Length])
+			}
+			buf = append(buf, data...)
+		case 1:
+			buf = append(buf, uint8(v))
+		case 2:
+			buf = order.AppendUint16(buf, uint16(v))
+		case 4:
+			buf = order.AppendUint32(buf, uint32(v))
+		case 8:
+			buf = order.AppendUint64(buf, v)
+		}
+	}
+
+	payload := b.Bytes()
+	out, err := b.PrependBytes(len(buf))
+	if err != nil {
+		return err
+	}
+	copy(out, buf)
+	// The whole message gets obfuscated, including anything after it
+	l.Protocol.xor(b.Bytes()[:len(buf)+len(payload)])
+	return nil
+}
@@ -0,0 +1,258 @@
+package layer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var chat = &Protocol{
+	Name:   "chat",
+	Header: []Field{{Name: "op", Size: 1}, {Name: "seq", Size: 4}},
+	Opcode: "op",
+	Messages: []Message{
+		{Opcode: 1, Name: "say", Fields: []Field{
+			{Name: "nick-len", Size: 1},
+			{Name: "nick", Length: "nick-len"},
+			{Name: "text"},
+		}},
+		{Opcode: 2, Name: "bye"},
+	},
+	Key: []byte{0xaa, 0x55},
+}
+
+func register(t *testing.T) gopacket.LayerType {
+	lt, err := chat.Register(9999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lt
+}
+
+func TestRoundTrip(t *testing.T) {
+	lt := register(t)
+	if again, _ := chat.Register(9999); again != lt {
+		t.Error("registering again gave a new layer type")
+	}
+	layers.RegisterUDPPortLayerType(9999, lt)
+
+	buf := new(bytes.Buffer)
+	cli, _ := pcapwriter.NewUDPv4Writers(buf, 1, buf, 2)
+	cli.DstPort = 9999
+	say := chat.New(1)
+	say.Values["seq"] = 7
+	say.Bytes["nick"] = []byte("neale")
+	say.Bytes["text"] = []byte("hi")
+	if _, err := cli.WritePacket(&cli.UDP, say); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	wire := packet.Layer(layers.LayerTypeUDP).LayerPayload()
+	if bytes.Contains(wire, []byte("neale")) {
+		t.Error("not obfuscated:", wire)
+	}
+	l, ok := packet.Layer(lt).(*Layer)
+	if !ok {
+		t.Fatal("no chat layer:", packet)
+	}
+	if l.Message().Name != "say" || l.Values["seq"] != 7 || l.Values["nick-len"] != 5 {
+		t.Error("wrong values:", l.Values)
+	}
+	if string(l.Bytes["nick"]) != "neale" || string(l.Bytes["text"]) != "hi" {
+		t.Error("wrong bytes:", l.Bytes)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	lt := register(t)
+	buf := gopacket.NewSerializeBuffer()
+	bye := chat.New(2)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, bye, gopacket.Payload("extra")); err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(buf.Bytes(), lt, gopacket.Default)
+	l := packet.Layer(lt).(*Layer)
+	if len(l.Contents) != 5 || string(l.Payload) != "extra" {
+		t.Errorf("wrong split: %x / %q", l.Contents, l.Payload)
+	}
+	if packet.ApplicationLayer() == nil {
+		t.Error("no payload layer")
+	}
+
+	// Unknown opcodes are just a header and a payload
+	buf.Clear()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, chat.New(9), gopacket.Payload("?"))
+	l = gopacket.NewPacket(buf.Bytes(), lt, gopacket.Default).Layer(lt).(*Layer)
+	if l.Message() != nil || string(l.Payload) != "?" {
+		t.Error("wrong decode of unknown opcode:", l.Values, l.Payload)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	lt := register(t)
+	packet := gopacket.NewPacket([]byte{0xab, 0x55, 0xaa}, lt, gopacket.Default)
+	if packet.ErrorLayer() == nil {
+		t.Error("short header decoded")
+	}
+
+	// A length too big to be an int, decoded directly
+	huge := &Protocol{
+		Name:   "huge",
+		Header: []Field{{Name: "len", Size: 8}, {Name: "data", Length: "len"}},
+		Opcode: "len",
+	}
+	l := huge.New(0)
+	data := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 'x'}
+	if err := l.DecodeFromBytes(data, gopacket.NilDecodeFeedback); !errors.Is(err, ErrShortData) {
+		t.Error("huge length decoded:", err)
+	}
+
+	// Lengths that don't match without FixLengths
+	say := chat.New(1)
+	say.Bytes["nick"] = []byte("x")
+	if err := gopacket.SerializeLayers(gopacket.NewSerializeBuffer(), gopacket.SerializeOptions{}, say); err == nil {
+		t.Error("wrong length serialized")
+	}
+
+	bad := []*Protocol{
+		{Name: "size", Header: []Field{{Name: "op", Size: 3}}, Opcode: "op"},
+		{Name: "opcode", Header: []Field{{Name: "op", Size: 1}}, Opcode: "kind"},
+		{Name: "length", Header: []Field{{Name: "op", Size: 1}, {Name: "data", Length: "len"}}, Opcode: "op"},
+		{Name: "rest", Header: []Field{{Name: "op", Size: 1}, {Name: "data"}, {Name: "crc", Size: 4}}, Opcode: "op"},
+		{Name: "header-rest", Header: []Field{{Name: "op", Size: 1}, {Name: "data"}}, Opcode: "op",
+			Messages: []Message{{Opcode: 1, Fields: []Field{{Name: "crc", Size: 4}}}}},
+	}
+	for _, p := range bad {
+		if err := p.Check(); err == nil {
+			t.Error("bad protocol passed:", p.Name)
+		}
+	}
+}
+
+func TestWriteDissector(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := chat.WriteDissector(buf, Dissector{UDPPort: 9999}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`local f_nick_len = ProtoField.uint8("chat.nick_len", "nick-len")`,
+		`local key = {0xaa, 0x55}`,
+		`DissectorTable.get("udp.port"):add(9999, proto)`,
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	bad := &Protocol{Name: "bad", Header: []Field{{Name: "op", Size: 3}}, Opcode: "op"}
+	if err := bad.WriteDissector(buf, Dissector{}); err == nil {
+		t.Error("bad protocol made a dissector")
+	}
+
+	// With the opcode after a variable-length field, only the port will do
+	named := &Protocol{
+		Name:   "named",
+		Header: []Field{{Name: "len", Size: 1}, {Name: "name", Length: "len"}, {Name: "op", Size: 1}},
+		Opcode: "op",
+	}
+	if err := named.WriteDissector(new(bytes.Buffer), Dissector{}); err == nil {
+		t.Error("heuristic-only dissector without a fixed opcode")
+	}
+	buf.Reset()
+	if err := named.WriteDissector(buf, Dissector{UDPPort: 9999}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("register_heuristic")) {
+		t.Error("heuristic registered without a fixed opcode")
+	}
+
+	// These all come out as a_b
+	clash := &Protocol{
+		Name:   "clash",
+		Header: []Field{{Name: "op", Size: 1}, {Name: "a-b", Size: 2}, {Name: "a_b", Size: 2}, {Name: "a.b", Size: 2}, {Name: "a_b_16", Size: 4}},
+		Opcode: "op",
+	}
+	fields, _ := clash.fieldVars("clash")
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if seen[f.Var] {
+			t.Errorf("%s declared twice", f.Var)
+		}
+		seen[f.Var] = true
+	}
+	if len(fields) != 5 {
+		t.Errorf("wanted 5 fields, got %d", len(fields))
+	}
+}
+
+// TestDissectorLoads has tshark run generated dissectors over a capture.
+func TestDissectorLoads(t *testing.T) {
+	tshark, err := exec.LookPath("tshark")
+	if err != nil {
+		t.Skip("no tshark")
+	}
+
+	say := chat.New(1)
+	say.Values["seq"] = 7
+	say.Bytes["nick"] = []byte("neale")
+	say.Bytes["text"] = []byte("hi")
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, say); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []Dissector{{UDPPort: 9999}, {}, {ICMP: true}} {
+		dir := t.TempDir()
+		lua := filepath.Join(dir, "chat.lua")
+		pcapFile := filepath.Join(dir, "chat.pcap")
+
+		f, err := os.Create(lua)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := chat.WriteDissector(f, d); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		f, err = os.Create(pcapFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcap, err := pcapwriter.NewWriter(f, time.Unix(1266879443, 0), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcap.WriteStandardHeader()
+		if d.ICMP {
+			req, _ := pcapwriter.NewICMPv4Writers(pcap, 1, pcap, 2)
+			req.Write(buf.Bytes())
+		} else {
+			cli, _ := pcapwriter.NewUDPv4Writers(pcap, 1, pcap, 2)
+			cli.DstPort = 9999
+			if d.UDPPort == 0 {
+				cli.DstPort = 5555
+			}
+			cli.Write(buf.Bytes())
+		}
+		f.Close()
+
+		out, err := exec.Command(tshark, "-r", pcapFile, "-X", "lua_script:"+lua, "-Y", "chat", "-T", "fields", "-e", "chat.seq").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%+v: %v\n%s", d, err, out)
+		}
+		if strings.TrimSpace(string(out)) != "7" {
+			t.Errorf("%+v: wrong tshark output:\n%s", d, out)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package layer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Dissector says where a generated Wireshark dissector looks for a protocol.
+type Dissector struct {
+	// UDP port to register on.
+	// If the opcode is at a fixed offset,
+	// the dissector also tries every other UDP payload, heuristically;
+	// otherwise it can't tell the protocol apart, and this port is required.
+	UDPPort uint16
+
+	// Look in ICMP echo payloads instead of UDP
+	ICMP bool
+}
+
+// luaName turns s into something usable as a Lua identifier or Wireshark filter name
+func luaName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, s)
+}
+
+type luaField struct {
+	Var    string
+	Abbrev string
+	Name   string
+	Type   string
+}
+
+type luaMessage struct {
+	Opcode uint64
+	Name   string
+	Code   string
+}
+
+type luaProtocol struct {
+	Dissector
+	ID          string
+	Name        string
+	Key         string
+	HeaderSize  int
+	OpcodeAt    int
+	OpcodeLast  int
+	LE          bool
+	OpcodeKnown bool
+	Names       string
+	Fields      []luaField
+	OpcodeVar   string
+	OpcodeName  string
+	Header      string
+	Messages    []luaMessage
+}
+
+// fieldVars gives each distinct field a ProtoField, named after it.
+// Fields sharing a name but not a size get the size tacked on,
+// then a counter, until the name is unique.
+func (p *Protocol) fieldVars(id string) ([]luaField, map[Field]string) {
+	var fields []luaField
+	vars := make(map[Field]string)
+	taken := make(map[string]bool)
+
+	all := append([]Field{}, p.Header...)
+	for _, m := range p.Messages {
+		all = append(all, m.Fields...)
+	}
+	for _, f := range all {
+		key := Field{Name: f.Name, Size: f.Size}
+		if _, ok := vars[key]; ok {
+			continue
+		}
+		name := luaName(f.Name)
+		if taken[name] {
+			name = fmt.Sprintf("%s_%d", name, f.Size*8)
+		}
+		for base, i := name, 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		taken[name] = true
+		vars[key] = "f_" + name
+
+		typ := "bytes"
+		if f.Size > 0 {
+			typ = fmt.Sprintf("uint%d", f.Size*8)
+		}
+		fields = append(fields, luaField{
+			Var:    "f_" + name,
+			Abbrev: id + "." + name,
+			Name:   f.Name,
+			Type:   typ,
+		})
+	}
+	return fields, vars
+}
+
+// luaRead returns Lua that adds fields to the tree, and records integer values
+func (p *Protocol) luaRead(fields []Field, vars map[Field]string, indent string) string {
+	get, add := "uint", "add"
+	if p.LittleEndian {
+		get, add = "le_uint", "add_le"
+	}
+
+	b := new(strings.Builder)
+	for _, f := range fields {
+		v := vars[Field{Name: f.Name, Size: f.Size}]
+		switch {
+		case f.Size == 8:
+			fmt.Fprintf(b, indent+"if plain:len() < off + 8 then return false end\n")
+			fmt.Fprintf(b, indent+"values[%q] = plain(off, 8):%s64():tonumber()\n", f.Name, get)
+			fmt.Fprintf(b, indent+"subtree:%s(%s, plain(off, 8))\n", add, v)
+			fmt.Fprintf(b, indent+"off = off + 8\n")
+		case f.Size > 0:
+			fmt.Fprintf(b, indent+"if plain:len() < off + %d then return false end\n", f.Size)
+			fmt.Fprintf(b, indent+"values[%q] = plain(off, %d):%s()\n", f.Name, f.Size, get)
+			fmt.Fprintf(b, indent+"subtree:%s(%s, plain(off, %d))\n", add, v, f.Size)
+			fmt.Fprintf(b, indent+"off = off + %d\n", f.Size)
+		default:
+			if f.Length != "" {
+				fmt.Fprintf(b, indent+"n = values[%q]\n", f.Length)
+			} else {
+				fmt.Fprintf(b, indent+"n = plain:len() - off\n")
+			}
+			fmt.Fprintf(b, indent+"if plain:len() < off + n then return false end\n")
+			fmt.Fprintf(b, indent+"if n > 0 then subtree:add(%s, plain(off, n)) end\n", v)
+			fmt.Fprintf(b, indent+"off = off + n\n")
+		}
+	}
+	return b.String()
+}
+
+// WriteDissector writes a Wireshark Lua dissector for p.
+//
+// Put it in Wireshark's plugins directory, or run wireshark -X lua_script:FILE.
+func (p *Protocol) WriteDissector(w io.Writer, d Dissector) error {
+	if err := p.Check(); err != nil {
+		return err
+	}
+
+	id := luaName(p.Name)
+	lp := luaProtocol{
+		Dissector:  d,
+		ID:         id,
+		Name:       p.Name,
+		LE:         p.LittleEndian,
+		OpcodeName: p.Opcode,
+	}
+	fields, vars := p.fieldVars(id)
+	lp.Fields = fields
+
+	var key []string
+	for _, k := range p.Key {
+		key = append(key, fmt.Sprintf("0x%02x", k))
+	}
+	lp.Key = strings.Join(key, ", ")
+
+	var names []string
+	for _, m := range p.Messages {
+		names = append(names, fmt.Sprintf("[%d] = %q", m.Opcode, m.Name))
+	}
+	lp.Names = strings.Join(names, ", ")
+
+	// Where the heuristic finds the opcode, if it can
+	variable := false
+	for _, f := range p.Header {
+		if f.Size == 0 {
+			variable = true
+			continue
+		}
+		if f.Name == p.Opcode {
+			lp.OpcodeVar = vars[f]
+			if !variable {
+				lp.OpcodeAt = lp.HeaderSize
+				lp.OpcodeLast = f.Size - 1
+				lp.OpcodeKnown = true
+			}
+		}
+		lp.HeaderSize += f.Size
+	}
+	if !d.ICMP && d.UDPPort == 0 && !lp.OpcodeKnown {
+		return fmt.Errorf("%s: opcode isn't at a fixed offset, so the dissector needs a UDP port", p.Name)
+	}
+
+	lp.Header = p.luaRead(p.Header, vars, "\t")
+	for _, m := range p.Messages {
+		lp.Messages = append(lp.Messages, luaMessage{
+			Opcode: m.Opcode,
+			Name:   m.Name,
+			Code:   strings.TrimSuffix(p.luaRead(m.Fields, vars, "\t\t"), "\n"),
+		})
+	}
+	return dissectorTemplate.Execute(w, lp)
+}
+
+var dissectorTemplate = template.Must(template.New("dissector").Parse(`-- Wireshark dissector for {{.Name}}, generated by pcapgen.
+--
+-- Load with: wireshark -X lua_script:{{.ID}}.lua
+
+local proto = Proto("{{.ID}}", "{{.Name}}")
+
+local names = { {{- .Names}}}
+
+{{range .Fields}}local {{.Var}} = ProtoField.{{.Type}}("{{.Abbrev}}", "{{.Name}}"{{if eq .Var $.OpcodeVar}}, base.HEX, names{{end}})
+{{end}}
+proto.fields = { {{- range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f.Var}}{{end}}}
+
+local key = { {{- .Key}}}
+
+-- deobfuscate undoes the XOR with key
+local function deobfuscate(tvb)
+	if #key == 0 then
+		return tvb
+	end
+	local ba = tvb:bytes()
+	for i = 0, ba:len() - 1 do
+		ba:set_index(i, bit.bxor(ba:get_index(i), key[i % #key + 1]))
+	end
+	return ba:tvb("Decoded {{.Name}}")
+end
+
+-- looks_like says whether tvb starts with a header and a known opcode
+local function looks_like(tvb)
+	if tvb:len() < {{.HeaderSize}} then
+		return false
+	end
+{{- if .OpcodeKnown}}
+	local op = 0
+	for i = 0, {{.OpcodeLast}} do
+		local b = tvb({{.OpcodeAt}} + i, 1):uint()
+		if #key > 0 then
+			b = bit.bxor(b, key[({{.OpcodeAt}} + i) % #key + 1])
+		end
+{{- if .LE}}
+		op = op + b * 256 ^ i
+{{- else}}
+		op = op * 256 + b
+{{- end}}
+	end
+	return names[op] ~= nil
+{{- else}}
+	return true
+{{- end}}
+end
+
+local function dissect(tvb, pinfo, tree)
+	local plain = deobfuscate(tvb)
+	local subtree = tree:add(proto, tvb(), "{{.Name}}")
+	local values = {}
+	local off = 0
+	local n
+
+	pinfo.cols.protocol = "{{.Name}}"
+{{.Header}}
+	local op = values["{{.OpcodeName}}"]
+{{- range $i, $m := .Messages}}
+	{{if $i}}else{{end}}if op == {{$m.Opcode}} then
+{{- if $m.Code}}
+{{$m.Code}}
+{{- end}}
+{{- end}}
+{{- if .Messages}}
+	end
+{{- end}}
+
+	pinfo.cols.info = names[op] or ("unknown opcode " .. tostring(op))
+	return true
+end
+
+{{if .ICMP -}}
+local icmp_type_field = Field.new("icmp.type")
+local data_field = Field.new("data")
+
+{{end -}}
+function proto.dissector(tvb, pinfo, tree)
+{{- if .ICMP}}
+	-- Called as a postdissector: pick out the ICMP payload
+	local icmp_type = icmp_type_field()
+	local data = data_field()
+	if not icmp_type or not data then
+		return
+	end
+	local t = icmp_type.value
+	if (t ~= 0 and t ~= 8) or not looks_like(data.range:tvb()) then
+		return
+	end
+	dissect(data.range:tvb(), pinfo, tree)
+{{- else}}
+	dissect(tvb, pinfo, tree)
+	return tvb:len()
+{{- end}}
+end
+{{if .ICMP}}
+register_postdissector(proto)
+{{- else}}
+{{- if .OpcodeKnown}}
+local function heuristic(tvb, pinfo, tree)
+	if not looks_like(tvb) then
+		return false
+	end
+	dissect(tvb, pinfo, tree)
+	return true
+end
+proto:register_heuristic("udp", heuristic)
+{{- end}}
+{{- if .UDPPort}}
+DissectorTable.get("udp.port"):add({{.UDPPort}}, proto)
+{{- end}}
+{{- end}}
+`))
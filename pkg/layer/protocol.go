@@ -0,0 +1,168 @@
+// Package layer turns a description of a puzzle protocol into a gopacket layer,
+// so tests can build and pick apart frames by field name,
+// instead of by byte offset.
+package layer
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+)
+
+// Field is one field of a message.
+type Field struct {
+	Name string
+
+	// Size of an integer field, in bytes: 1, 2, 4, or 8.
+	// 0 is a byte string, whose length is in the integer field named by Length,
+	// or which runs to the end of the message if Length is empty;
+	// only the last field can run to the end.
+	Size int
+
+	// For byte strings, the field holding the length
+	Length string `json:",omitempty"`
+}
+
+// Message is the body following the header, for one opcode.
+type Message struct {
+	Opcode uint64
+	Name   string
+	Fields []Field
+}
+
+// Protocol describes a puzzle protocol:
+// a header, one of whose fields is an opcode saying which message follows.
+type Protocol struct {
+	Name string
+
+	// Header fields, common to every message
+	Header []Field
+
+	// Name of the header field holding the opcode
+	Opcode string
+
+	Messages []Message
+
+	// Little-endian integers, instead of network byte order
+	LittleEndian bool `json:",omitempty"`
+
+	// If set, every message is XORed with this, repeated
+	Key []byte `json:",omitempty"`
+
+	layerType gopacket.LayerType
+}
+
+// byteOrder is what binary.LittleEndian and binary.BigEndian both do
+type byteOrder interface {
+	Uint16([]byte) uint16
+	Uint32([]byte) uint32
+	Uint64([]byte) uint64
+	AppendUint16([]byte, uint16) []byte
+	AppendUint32([]byte, uint32) []byte
+	AppendUint64([]byte, uint64) []byte
+}
+
+func (p *Protocol) byteOrder() byteOrder {
+	if p.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Message returns the message with the given opcode, or nil if there isn't one
+func (p *Protocol) Message(opcode uint64) *Message {
+	for i := range p.Messages {
+		if p.Messages[i].Opcode == opcode {
+			return &p.Messages[i]
+		}
+	}
+	return nil
+}
+
+// Check returns an error if p doesn't make sense
+func (p *Protocol) Check() error {
+	// rest is set once a field runs to the end of the data
+	rest := false
+	check := func(fields []Field, ints map[string]bool) error {
+		for _, f := range fields {
+			if rest {
+				return fmt.Errorf("%s: field %s comes after a field running to the end", p.Name, f.Name)
+			}
+			switch f.Size {
+			case 1, 2, 4, 8:
+				ints[f.Name] = true
+			case 0:
+				if f.Length == "" {
+					rest = true
+				} else if !ints[f.Length] {
+					return fmt.Errorf("%s: length of %s must be an earlier integer field, not %q", p.Name, f.Name, f.Length)
+				}
+			default:
+				return fmt.Errorf("%s: field %s has bad size %d", p.Name, f.Name, f.Size)
+			}
+		}
+		return nil
+	}
+
+	ints := make(map[string]bool)
+	if err := check(p.Header, ints); err != nil {
+		return err
+	}
+	headerRest := rest
+	if !ints[p.Opcode] {
+		return fmt.Errorf("%s: opcode must be an integer header field, not %q", p.Name, p.Opcode)
+	}
+	for _, m := range p.Messages {
+		msgInts := make(map[string]bool)
+		for k := range ints {
+			msgInts[k] = true
+		}
+		rest = headerRest
+		if err := check(m.Fields, msgInts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register registers p with gopacket as layer type num, and returns the new layer type.
+// See gopacket.RegisterLayerType for which numbers to use.
+//
+// Registering again returns the same layer type.
+func (p *Protocol) Register(num int) (gopacket.LayerType, error) {
+	if p.layerType != 0 {
+		return p.layerType, nil
+	}
+	if err := p.Check(); err != nil {
+		return 0, err
+	}
+	p.layerType = gopacket.RegisterLayerType(num, gopacket.LayerTypeMetadata{
+		Name:    p.Name,
+		Decoder: gopacket.DecodeFunc(p.decode),
+	})
+	return p.layerType, nil
+}
+
+// LayerType returns p's layer type, once registered
+func (p *Protocol) LayerType() gopacket.LayerType {
+	return p.layerType
+}
+
+// New returns an empty layer for a message with the given opcode
+func (p *Protocol) New(opcode uint64) *Layer {
+	return &Layer{
+		Protocol: p,
+		Values:   map[string]uint64{p.Opcode: opcode},
+		Bytes:    make(map[string][]byte),
+	}
+}
+
+func (p *Protocol) decode(data []byte, pb gopacket.PacketBuilder) error {
+	l := &Layer{Protocol: p}
+	if err := l.DecodeFromBytes(data, pb); err != nil {
+		return err
+	}
+	pb.AddLayer(l)
+	return pb.NextDecoder(l.NextLayerType())
+}
@@ -0,0 +1,195 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// streams reassembles the TCP payload sent by each side
+type streams struct {
+	port   layers.TCPPort
+	client bytes.Buffer
+	server bytes.Buffer
+}
+
+func (s *streams) Write(frame []byte) (int, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp.SrcPort == s.port {
+		s.server.Write(tcp.Payload)
+	} else {
+		s.client.Write(tcp.Payload)
+	}
+	return len(frame), nil
+}
+
+// converse runs write over a TCP connection to port
+func converse(t *testing.T, port layers.TCPPort, write func(client, server io.Writer) error) *streams {
+	t.Helper()
+	s := &streams{port: port}
+	cli, srv := pcapwriter.NewTCPv4Writers(s, 0x0b, s, 0x37)
+	cli.DstPort = port
+	srv.SrcPort = port
+	if err := write(cli, srv); err != nil {
+		t.Fatal(err)
+	}
+	cli.Close()
+	srv.Close()
+	return s
+}
+
+var testMessage = Message{
+	From:      "Alice <alice@example.com>",
+	To:        []string{"bob@example.net"},
+	Subject:   "The plans",
+	Date:      time.Date(2010, 2, 22, 22, 57, 23, 0, time.UTC),
+	MessageID: "1234@example.com",
+	Body:      "See attached.\n.\nAlice\n",
+	Attachments: []Attachment{
+		{Filename: "plans.bin", ContentType: "application/octet-stream", Data: bytes.Repeat([]byte{0, 1, 2, 0xff}, 100)},
+	},
+}
+
+// checkMessage parses an encoded message, and compares it to testMessage
+func checkMessage(t *testing.T, data []byte) {
+	t.Helper()
+	msg, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != testMessage.Subject {
+		t.Error("wrong subject:", msg.Header.Get("Subject"))
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := io.ReadAll(body)
+	if string(text) != "See attached.\r\n.\r\nAlice\r\n" {
+		t.Errorf("wrong body: %q", text)
+	}
+
+	att, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if att.FileName() != "plans.bin" {
+		t.Error("wrong filename:", att.FileName())
+	}
+	got, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, att))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, testMessage.Attachments[0].Data) {
+		t.Error("attachment corrupted")
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Error("extra parts:", err)
+	}
+}
+
+// undot reverses dot-stuffing, returning the message before the terminating line
+func undot(t *testing.T, s string) []byte {
+	t.Helper()
+	end := strings.Index(s, "\r\n.\r\n")
+	if end < 0 {
+		t.Fatal("no terminating line")
+	}
+	s = s[:end+2]
+	return []byte(strings.ReplaceAll(s, "\r\n..", "\r\n."))
+}
+
+func TestEncode(t *testing.T) {
+	a, err := testMessage.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := testMessage.Encode()
+	if !bytes.Equal(a, b) {
+		t.Error("encoding isn't repeatable")
+	}
+	checkMessage(t, a)
+}
+
+func TestSMTP(t *testing.T) {
+	for _, auth := range []string{"PLAIN", "LOGIN"} {
+		smtp := &SMTP{
+			ServerName: "mx.example.net",
+			ClientName: "laptop",
+			Username:   "alice",
+			Password:   "hunter2",
+			Auth:       auth,
+			Messages:   []Message{testMessage},
+		}
+		s := converse(t, SMTPPort, smtp.Write)
+		client := s.client.String()
+
+		if !strings.HasPrefix(s.server.String(), "220 mx.example.net") {
+			t.Error("no banner")
+		}
+		if !strings.Contains(client, "RCPT TO:<bob@example.net>\r\n") || !strings.Contains(client, "MAIL FROM:<alice@example.com>\r\n") {
+			t.Errorf("%s: wrong envelope:\n%s", auth, client)
+		}
+		creds := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+		if auth == "PLAIN" {
+			creds = base64.StdEncoding.EncodeToString([]byte("\x00alice\x00hunter2"))
+		}
+		if !strings.Contains(client, creds) {
+			t.Errorf("%s: credentials not sent", auth)
+		}
+
+		_, data, _ := strings.Cut(client, "DATA\r\n")
+		checkMessage(t, undot(t, data))
+	}
+}
+
+func TestPOP3(t *testing.T) {
+	pop := &POP3{Username: "bob", Password: "swordfish", Messages: []Message{testMessage, testMessage}, Delete: true}
+	s := converse(t, POP3Port, pop.Write)
+
+	if !strings.Contains(s.client.String(), "RETR 2\r\nDELE 2\r\n") {
+		t.Errorf("wrong commands:\n%s", s.client.String())
+	}
+	_, data, found := strings.Cut(s.server.String(), "octets\r\n")
+	if !found {
+		t.Fatal("no RETR response")
+	}
+	checkMessage(t, undot(t, data))
+}
+
+func TestIMAP(t *testing.T) {
+	imap := &IMAP{Username: "bob", Password: "swordfish", Messages: []Message{testMessage}}
+	s := converse(t, IMAPPort, imap.Write)
+
+	encoded, _ := testMessage.Encode()
+	server := s.server.String()
+	_, data, found := strings.Cut(server, "BODY[] {")
+	if !found {
+		t.Fatal("no FETCH response")
+	}
+	_, data, _ = strings.Cut(data, "}\r\n")
+	if !strings.HasPrefix(data, string(encoded)+")\r\na003 OK") {
+		t.Error("wrong literal")
+	}
+	checkMessage(t, []byte(data[:len(encoded)]))
+	if !strings.HasSuffix(s.client.String(), "a004 LOGOUT\r\n") {
+		t.Error("no logout")
+	}
+}
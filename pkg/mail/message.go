@@ -0,0 +1,185 @@
+// Package mail generates email, and the SMTP, POP3, and IMAP sessions
+// that send and retrieve it.
+//
+// Sessions are written to a client/server pair of writers,
+// like the ones from pcapwriter.NewTCPv4Conversation,
+// so tools like Wireshark can reassemble them and export their objects.
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// FileAttachment returns an Attachment holding the contents of the file called name,
+// with a content type guessed from its extension.
+func FileAttachment(name string) (Attachment, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Attachment{}, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Attachment{
+		Filename:    filepath.Base(name),
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// Message is an email message
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+
+	// If zero, there's no Date header
+	Date time.Time
+
+	// If empty, there's no Message-ID header
+	MessageID string
+
+	// Plain text body
+	Body string
+
+	// If set, the message is multipart/mixed
+	Attachments []Attachment
+}
+
+// crlf converts line endings to CRLF
+func crlf(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// base64Lines encodes data as base64, in 76-character lines
+func base64Lines(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+	buf := new(bytes.Buffer)
+	for len(enc) > 76 {
+		buf.WriteString(enc[:76])
+		buf.WriteString("\r\n")
+		enc = enc[76:]
+	}
+	buf.WriteString(enc)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// boundary is derived from the message contents,
+// so the same message always encodes the same way.
+func (m *Message) boundary() string {
+	h := sha256.New()
+	h.Write([]byte(m.Body))
+	for _, a := range m.Attachments {
+		h.Write([]byte(a.Filename))
+		h.Write(a.Data)
+	}
+	return fmt.Sprintf("----=_Part_%x", h.Sum(nil)[:12])
+}
+
+// Encode returns m in RFC 5322 format, with CRLF line endings.
+func (m *Message) Encode() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	header := func(name, value string) {
+		fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	if !m.Date.IsZero() {
+		header("Date", m.Date.Format(time.RFC1123Z))
+	}
+	if m.MessageID != "" {
+		header("Message-ID", "<"+m.MessageID+">")
+	}
+	header("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "8bit")
+		buf.WriteString("\r\n")
+		buf.WriteString(crlf(m.Body))
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	if err := mw.SetBoundary(m.boundary()); err != nil {
+		return nil, err
+	}
+	header("Content-Type", "multipart/mixed; boundary=\""+mw.Boundary()+"\"")
+	buf.WriteString("\r\nThis is a multi-part message in MIME format.\r\n")
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "8bit")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(crlf(m.Body))); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Filename}))
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+		h.Set("Content-Transfer-Encoding", "base64")
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(base64Lines(a.Data)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// dotStuff prepares an encoded message for SMTP DATA or POP3 RETR,
+// doubling leading dots and adding the terminating line.
+func dotStuff(msg []byte) []byte {
+	buf := new(bytes.Buffer)
+	for _, line := range strings.SplitAfter(string(msg), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == '.' {
+			buf.WriteString(".")
+		}
+		buf.WriteString(line)
+	}
+	if !bytes.HasSuffix(msg, []byte("\r\n")) && len(msg) > 0 {
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString(".\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,237 @@
+package mail
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Well-known ports
+const (
+	SMTPPort       = 25
+	SubmissionPort = 587
+	POP3Port       = 110
+	IMAPPort       = 143
+)
+
+// session writes lines from each side
+type session struct {
+	client io.Writer
+	server io.Writer
+	err    error
+}
+
+// send writes one chunk of protocol from w, unless an earlier write failed
+func (s *session) send(w io.Writer, lines ...string) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = w.Write([]byte(strings.Join(lines, "")))
+}
+
+func (s *session) c(format string, a ...interface{}) {
+	s.send(s.client, fmt.Sprintf(format, a...)+"\r\n")
+}
+
+func (s *session) s(format string, a ...interface{}) {
+	s.send(s.server, fmt.Sprintf(format, a...)+"\r\n")
+}
+
+// SMTP describes a session delivering messages to a mail server.
+type SMTP struct {
+	// Host names given in the server banner and the client's EHLO
+	ServerName string
+	ClientName string
+
+	// If Username is set, the client authenticates first.
+	// Auth is PLAIN (the default) or LOGIN.
+	Username string
+	Password string
+	Auth     string
+
+	Messages []Message
+}
+
+// Write writes the session, with the client's commands to client
+// and the server's replies to server.
+func (m *SMTP) Write(client io.Writer, server io.Writer) error {
+	s := &session{client: client, server: server}
+	s.s("220 %s ESMTP Postfix", m.ServerName)
+	s.c("EHLO %s", m.ClientName)
+	s.s("250-%s\r\n250-PIPELINING\r\n250-SIZE 10240000\r\n250-AUTH PLAIN LOGIN\r\n250-8BITMIME\r\n250 SMTPUTF8", m.ServerName)
+
+	if m.Username != "" {
+		switch strings.ToUpper(m.Auth) {
+		case "", "PLAIN":
+			creds := base64.StdEncoding.EncodeToString([]byte("\x00" + m.Username + "\x00" + m.Password))
+			s.c("AUTH PLAIN %s", creds)
+		case "LOGIN":
+			s.c("AUTH LOGIN")
+			s.s("334 VXNlcm5hbWU6") // Username:
+			s.c("%s", base64.StdEncoding.EncodeToString([]byte(m.Username)))
+			s.s("334 UGFzc3dvcmQ6") // Password:
+			s.c("%s", base64.StdEncoding.EncodeToString([]byte(m.Password)))
+		default:
+			return fmt.Errorf("unknown SMTP auth mechanism: %s", m.Auth)
+		}
+		s.s("235 2.7.0 Authentication successful")
+	}
+
+	for i, msg := range m.Messages {
+		data, err := msg.Encode()
+		if err != nil {
+			return err
+		}
+		s.c("MAIL FROM:<%s>", address(msg.From))
+		s.s("250 2.1.0 Ok")
+		for _, to := range msg.To {
+			s.c("RCPT TO:<%s>", address(to))
+			s.s("250 2.1.5 Ok")
+		}
+		s.c("DATA")
+		s.s("354 End data with <CR><LF>.<CR><LF>")
+		s.send(client, string(dotStuff(data)))
+		s.s("250 2.0.0 Ok: queued as %05X", 0x1a2b3+i)
+	}
+
+	s.c("QUIT")
+	s.s("221 2.0.0 Bye")
+	return s.err
+}
+
+// address pulls the bare address out of something like "Name <user@host>"
+func address(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		s = s[i+1:]
+		s = strings.TrimSuffix(s, ">")
+	}
+	return strings.TrimSpace(s)
+}
+
+// POP3 describes a session retrieving every message from a mailbox.
+type POP3 struct {
+	ServerName string
+	Username   string
+	Password   string
+
+	Messages []Message
+
+	// Delete each message after retrieving it
+	Delete bool
+}
+
+// Write writes the session, with the client's commands to client
+// and the server's replies to server.
+func (p *POP3) Write(client io.Writer, server io.Writer) error {
+	var encoded [][]byte
+	total := 0
+	for _, msg := range p.Messages {
+		data, err := msg.Encode()
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, data)
+		total += len(data)
+	}
+
+	s := &session{client: client, server: server}
+	s.s("+OK %s POP3 server ready", p.ServerName)
+	s.c("USER %s", p.Username)
+	s.s("+OK")
+	s.c("PASS %s", p.Password)
+	s.s("+OK Logged in.")
+	s.c("STAT")
+	s.s("+OK %d %d", len(encoded), total)
+
+	list := fmt.Sprintf("+OK %d messages:\r\n", len(encoded))
+	for i, data := range encoded {
+		list += fmt.Sprintf("%d %d\r\n", i+1, len(data))
+	}
+	s.c("LIST")
+	s.send(server, list, ".\r\n")
+
+	for i, data := range encoded {
+		s.c("RETR %d", i+1)
+		s.send(server, fmt.Sprintf("+OK %d octets\r\n", len(data)), string(dotStuff(data)))
+		if p.Delete {
+			s.c("DELE %d", i+1)
+			s.s("+OK Marked to be deleted.")
+		}
+	}
+
+	s.c("QUIT")
+	s.s("+OK Logging out.")
+	return s.err
+}
+
+// IMAP describes a session fetching every message in a mailbox.
+type IMAP struct {
+	ServerName string
+	Username   string
+	Password   string
+
+	// Mailbox to select; if empty, INBOX
+	Mailbox string
+
+	Messages []Message
+}
+
+// quote returns s as an IMAP quoted string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Write writes the session, with the client's commands to client
+// and the server's replies to server.
+func (m *IMAP) Write(client io.Writer, server io.Writer) error {
+	mailbox := m.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	s := &session{client: client, server: server}
+	tag := 0
+	next := func() string {
+		tag += 1
+		return fmt.Sprintf("a%03d", tag)
+	}
+
+	s.s("* OK [CAPABILITY IMAP4rev1 LITERAL+ SASL-IR LOGIN-REFERRALS ID ENABLE IDLE AUTH=PLAIN] %s ready.", m.ServerName)
+
+	t := next()
+	s.c("%s LOGIN %s %s", t, quote(m.Username), quote(m.Password))
+	s.s("%s OK Logged in", t)
+
+	t = next()
+	s.c("%s SELECT %s", t, quote(mailbox))
+	s.send(server,
+		"* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)\r\n",
+		fmt.Sprintf("* %d EXISTS\r\n", len(m.Messages)),
+		"* 0 RECENT\r\n",
+		"* OK [UIDVALIDITY 1262304000] UIDs valid\r\n",
+		fmt.Sprintf("* OK [UIDNEXT %d] Predicted next UID\r\n", len(m.Messages)+1),
+		fmt.Sprintf("%s OK [READ-WRITE] Select completed.\r\n", t),
+	)
+
+	for i, msg := range m.Messages {
+		data, err := msg.Encode()
+		if err != nil {
+			return err
+		}
+		t = next()
+		s.c("%s FETCH %d BODY[]", t, i+1)
+		s.send(server,
+			fmt.Sprintf("* %d FETCH (FLAGS (\\Seen) BODY[] {%d}\r\n", i+1, len(data)),
+			string(data),
+			")\r\n",
+			fmt.Sprintf("%s OK Fetch completed.\r\n", t),
+		)
+	}
+
+	t = next()
+	s.c("%s LOGOUT", t)
+	s.send(server, "* BYE Logging out\r\n", fmt.Sprintf("%s OK Logout completed.\r\n", t))
+	return s.err
+}
@@ -0,0 +1,157 @@
+package noise
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/dns"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+// generators write one background exchange each
+var generators = map[string]func(n *Noise, c *clock) error{
+	"dns":   dnsLookup,
+	"https": httpsSession,
+	"ntp":   ntpQuery,
+	"ping":  ping,
+}
+
+func (n *Noise) client() uint8 {
+	return n.Clients[n.intn(len(n.Clients))]
+}
+
+func (n *Noise) server() uint8 {
+	return n.Servers[n.intn(len(n.Servers))]
+}
+
+// ephemeral returns a port in the Linux ephemeral range
+func (n *Noise) ephemeral() uint16 {
+	return uint16(32768 + n.intn(61000-32768))
+}
+
+func (n *Noise) random(size int) []byte {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(n.intn(256))
+	}
+	return buf
+}
+
+// dnsLookup resolves a name to one of the servers
+func dnsLookup(n *Noise, c *clock) error {
+	g := dns.NewGenerator(c, n.client(), n.Resolver)
+	g.Rand = n.Rand
+	srv := n.server()
+	return g.Write(dns.Exchange{
+		Name: n.Names[n.intn(len(n.Names))],
+		Type: dns.TypeA,
+		Answers: []dns.Record{
+			{Type: dns.TypeA, TTL: 300, Data: fmt.Sprintf("192.168.%d.%d", srv, srv)},
+		},
+	})
+}
+
+// record returns a TLS record header and random contents
+func (n *Noise) record(contentType byte, size int) []byte {
+	rec := []byte{contentType, 3, 3, byte(size >> 8), byte(size)}
+	return append(rec, n.random(size)...)
+}
+
+// httpsSession looks like a short TLS session:
+// a handshake, a request, and a response.
+// It's only random bytes inside the records.
+func httpsSession(n *Noise, c *clock) error {
+	cli, srv := pcapwriter.NewTCPv4Writers(c, n.client(), c, n.server())
+	port := layers.TCPPort(n.ephemeral())
+	cli.SrcPort, cli.DstPort = port, 443
+	srv.SrcPort, srv.DstPort = 443, port
+	cli.Seq = uint32(n.intn(1<<31)) << 1
+	srv.Seq = uint32(n.intn(1<<31)) << 1
+
+	for _, w := range []struct {
+		t    *pcapwriter.TCPv4Writer
+		data []byte
+	}{
+		{cli, n.record(22, 200+n.intn(300))},
+		{srv, n.record(22, 1500+n.intn(2500))},
+		{cli, n.record(20, 1)},
+		{cli, n.record(23, 100+n.intn(500))},
+		{srv, n.record(23, 500+n.intn(16000))},
+	} {
+		if _, err := w.t.Write(w.data); err != nil {
+			return err
+		}
+	}
+	if err := cli.Close(); err != nil {
+		return err
+	}
+	return srv.Close()
+}
+
+// ntpTime converts t to an NTP timestamp
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + 2208988800)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+// ntpQuery is an SNTP client asking a server the time
+func ntpQuery(n *Noise, c *clock) error {
+	cli, srv := pcapwriter.NewUDPv4Writers(c, n.client(), c, n.server())
+	port := layers.UDPPort(n.ephemeral())
+	cli.SrcPort, cli.DstPort = port, 123
+	srv.SrcPort, srv.DstPort = 123, port
+
+	// Leap indicator 0, version 4, mode 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0x23
+	binary.BigEndian.PutUint64(req[40:], ntpTime(c.now))
+	if _, err := cli.Write(req); err != nil {
+		return err
+	}
+
+	// Mode 4 (server), stratum 2
+	resp := make([]byte, 48)
+	resp[0] = 0x24
+	resp[1] = 2
+	resp[2] = 6
+	resp[3] = 0xe9
+	copy(resp[12:16], []byte{192, 168, n.Resolver, n.Resolver})
+	binary.BigEndian.PutUint64(resp[16:], ntpTime(c.now.Add(-17*time.Minute)))
+	copy(resp[24:32], req[40:48])
+	binary.BigEndian.PutUint64(resp[32:], ntpTime(c.now))
+	binary.BigEndian.PutUint64(resp[40:], ntpTime(c.now))
+	_, err := srv.Write(resp)
+	return err
+}
+
+// ping sends a few echo requests a second apart, like Linux ping
+func ping(n *Noise, c *clock) error {
+	cli, srv := pcapwriter.NewICMPv4Writers(c, n.client(), c, n.server())
+	cli.Id = uint16(n.intn(0x10000))
+	srv.Id = cli.Id
+
+	count := 1 + n.intn(4)
+	for i := 0; i < count; i++ {
+		// struct timeval, then the pattern 0x10, 0x11, ...
+		payload := make([]byte, 56)
+		binary.LittleEndian.PutUint64(payload, uint64(c.now.Unix()))
+		binary.LittleEndian.PutUint64(payload[8:], uint64(c.now.Nanosecond()/1000))
+		for j := 16; j < len(payload); j++ {
+			payload[j] = byte(j)
+		}
+
+		cli.Seq = uint16(i + 1)
+		srv.Seq = cli.Seq
+		if _, err := cli.Write(payload); err != nil {
+			return err
+		}
+		if _, err := srv.Write(payload); err != nil {
+			return err
+		}
+		c.Sleep(time.Second)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package noise interleaves plausible background traffic
+// around a generated conversation,
+// so the interesting flow isn't the only thing in the capture.
+package noise
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+// Share is one kind of traffic, and how much of the mix it makes up
+type Share struct {
+	Kind   string
+	Weight float64
+}
+
+// Mix is the proportion of each kind of traffic.
+// Weights are relative, and needn't add up to 100.
+type Mix []Share
+
+// DefaultMix is a little of everything
+var DefaultMix = Mix{
+	{"dns", 40},
+	{"https", 30},
+	{"ntp", 10},
+	{"ping", 20},
+}
+
+// ParseMix parses a mix like "dns=40,https=30,ntp=10,ping=20".
+//
+// Known kinds are dns, https, ntp, and ping.
+func ParseMix(s string) (Mix, error) {
+	var mix Mix
+	for _, part := range strings.Split(s, ",") {
+		kind, weight, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return nil, fmt.Errorf("no weight for %q", part)
+		}
+		if _, ok := generators[kind]; !ok {
+			return nil, fmt.Errorf("unknown traffic kind: %q", kind)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad weight for %s: %q", kind, weight)
+		}
+		mix = append(mix, Share{kind, w})
+	}
+	return mix, nil
+}
+
+// frame is a rendered frame, waiting for its turn
+type frame struct {
+	when time.Time
+	data []byte
+}
+
+// Noise writes frames to an underlying writer,
+// interleaving background traffic from simulated hosts.
+//
+// Background exchanges start at random, on average every Rate,
+// and their frames are written in timestamp order
+// as the main conversation's frames go by.
+type Noise struct {
+	pcap *pcapwriter.Writer
+	w    io.Writer
+
+	// Proportion of each kind of traffic
+	Mix Mix
+
+	// Mean time between the starts of background exchanges
+	Rate time.Duration
+
+	// Upper limit on the delay before each frame within an exchange
+	RTT time.Duration
+
+	// No exchanges start after End; if zero, they go on as long as there's traffic
+	End time.Time
+
+	// Host numbers of simulated clients, servers, and the DNS resolver
+	Clients  []uint8
+	Servers  []uint8
+	Resolver uint8
+
+	// Names looked up by DNS clients
+	Names []string
+
+	// Source of everything; if nil, the math/rand default source is used
+	Rand *rand.Rand
+
+	next    time.Time
+	pending []frame
+}
+
+// New returns a Noise writing to w, which usually is pcap,
+// or something between the two, like a lan.Segment.
+//
+// pcap provides the clock.
+func New(pcap *pcapwriter.Writer, w io.Writer, mix Mix) *Noise {
+	return &Noise{
+		pcap:     pcap,
+		w:        w,
+		Mix:      mix,
+		Rate:     2 * time.Second,
+		RTT:      30 * time.Millisecond,
+		Clients:  []uint8{100, 101, 102, 103, 104},
+		Servers:  []uint8{200, 201, 202, 203},
+		Resolver: 1,
+		Names: []string{
+			"www.example.com",
+			"mail.example.com",
+			"cdn.example.net",
+			"updates.example.org",
+			"time.example.org",
+			"api.example.com",
+		},
+	}
+}
+
+func (n *Noise) intn(i int) int {
+	return pcapwriter.Random(n.Rand).Intn(i)
+}
+
+func (n *Noise) float64() float64 {
+	return pcapwriter.Random(n.Rand).Float64()
+}
+
+func (n *Noise) gap() time.Duration {
+	e := pcapwriter.Random(n.Rand).ExpFloat64()
+	return time.Duration(e * float64(n.Rate))
+}
+
+// pick chooses a kind of traffic according to Mix
+func (n *Noise) pick() string {
+	total := 0.0
+	for _, s := range n.Mix {
+		total += s.Weight
+	}
+	r := n.float64() * total
+	for _, s := range n.Mix {
+		if r < s.Weight {
+			return s.Kind
+		}
+		r -= s.Weight
+	}
+	return ""
+}
+
+// render generates every exchange starting by until,
+// adding its frames to pending.
+func (n *Noise) render(until time.Time) error {
+	if len(n.Mix) == 0 || n.Rate <= 0 {
+		return nil
+	}
+	if n.next.IsZero() {
+		n.next = n.pcap.Now.Add(n.gap())
+	}
+	for !n.next.After(until) {
+		if !n.End.IsZero() && n.next.After(n.End) {
+			break
+		}
+		gen, ok := generators[n.pick()]
+		if ok {
+			c := &clock{n: n, now: n.next}
+			if err := gen(n, c); err != nil {
+				return err
+			}
+		}
+		n.next = n.next.Add(n.gap())
+	}
+	sort.SliceStable(n.pending, func(i, j int) bool {
+		return n.pending[i].when.Before(n.pending[j].when)
+	})
+	return nil
+}
+
+// emit writes pending frames due by until, each with its own timestamp
+func (n *Noise) emit(until time.Time) error {
+	now := n.pcap.Now
+	defer func() {
+		n.pcap.Now = now
+	}()
+
+	for len(n.pending) > 0 && !n.pending[0].when.After(until) {
+		f := n.pending[0]
+		n.pending = n.pending[1:]
+		n.pcap.Now = f.when
+		if _, err := n.w.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes every background frame that has come due.
+//
+// Write calls this automatically.
+func (n *Noise) Flush() error {
+	if err := n.render(n.pcap.Now); err != nil {
+		return err
+	}
+	return n.emit(n.pcap.Now)
+}
+
+// Finish writes background traffic through End,
+// and finishes any exchanges still in progress.
+// The clock is left after the last frame.
+func (n *Noise) Finish() error {
+	end := n.pcap.Now
+	if n.End.After(end) {
+		end = n.End
+	}
+	if err := n.render(end); err != nil {
+		return err
+	}
+	if len(n.pending) > 0 {
+		if last := n.pending[len(n.pending)-1].when; last.After(end) {
+			end = last
+		}
+	}
+	if err := n.emit(end); err != nil {
+		return err
+	}
+	if end.After(n.pcap.Now) {
+		n.pcap.Now = end
+	}
+	return nil
+}
+
+// Write passes a frame through, after any due background frames
+func (n *Noise) Write(frame []byte) (int, error) {
+	if err := n.Flush(); err != nil {
+		return 0, err
+	}
+	return n.w.Write(frame)
+}
+
+// clock records frames of one background exchange,
+// pausing up to RTT before each.
+type clock struct {
+	n   *Noise
+	now time.Time
+}
+
+func (c *clock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func (c *clock) Write(p []byte) (int, error) {
+	if c.n.RTT > 0 {
+		c.Sleep(time.Duration(c.n.intn(int(c.n.RTT))))
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	c.n.pending = append(c.n.pending, frame{c.now, data})
+	return len(p), nil
+}
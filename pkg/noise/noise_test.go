@@ -0,0 +1,117 @@
+package noise
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("dns=40, https=30,ntp=10,ping=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mix) != 4 || mix[1] != (Share{"https", 30}) {
+		t.Error("wrong mix:", mix)
+	}
+
+	for _, bad := range []string{"dns", "smtp=10", "dns=lots", "dns=-1"} {
+		if _, err := ParseMix(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+// capture writes a UDP conversation with noise around it
+func capture(t *testing.T, seed int64) []byte {
+	buf := new(bytes.Buffer)
+	pcap, err := pcapwriter.NewWriter(buf, time.Unix(1000, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcap.WriteStandardHeader()
+
+	n := New(pcap, pcap, DefaultMix)
+	n.Rand = rand.New(rand.NewSource(seed))
+	n.End = pcap.Now.Add(2 * time.Minute)
+
+	conv := pcapwriter.NewUDPv4Conversation(n, 0x0b, 0x37)
+	for i := 0; i < 10; i++ {
+		conv.Client().Write([]byte("alpha"))
+		pcap.Sleep(5 * time.Second)
+		conv.Server().Write([]byte("beta"))
+	}
+	if err := n.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if pcap.Now.Before(n.End) {
+		t.Error("Finish didn't reach End")
+	}
+	return buf.Bytes()
+}
+
+func TestNoise(t *testing.T) {
+	data := capture(t, 1)
+	if !bytes.Equal(data, capture(t, 1)) {
+		t.Error("same seed, different capture")
+	}
+	if bytes.Equal(data, capture(t, 2)) {
+		t.Error("different seed, same capture")
+	}
+
+	r, err := pcapgo.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last time.Time
+	main := 0
+	counts := map[string]int{}
+	for {
+		frame, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		if ci.Timestamp.Before(last) {
+			t.Error("frame out of order at", ci.Timestamp)
+		}
+		last = ci.Timestamp
+
+		packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+		if err := packet.ErrorLayer(); err != nil {
+			t.Fatal(err.Error())
+		}
+		switch l := packet.TransportLayer().(type) {
+		case *layers.UDP:
+			switch {
+			case l.SrcPort == 0x0b || l.SrcPort == 0x37:
+				main += 1
+			case l.DstPort == 53:
+				counts["dns"] += 1
+			case l.DstPort == 123:
+				counts["ntp"] += 1
+			}
+		case *layers.TCP:
+			if l.SYN && !l.ACK && l.DstPort == 443 {
+				counts["https"] += 1
+			}
+		default:
+			if icmp, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok && icmp.TypeCode.Type() == layers.ICMPv4TypeEchoRequest {
+				counts["ping"] += 1
+			}
+		}
+	}
+	if main != 20 {
+		t.Error("main conversation has wrong number of frames:", main)
+	}
+	for _, s := range DefaultMix {
+		if counts[s.Kind] == 0 {
+			t.Errorf("no %s traffic: %v", s.Kind, counts)
+		}
+	}
+}
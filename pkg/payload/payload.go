@@ -0,0 +1,196 @@
+// Package payload builds binary payloads from Go templates,
+// for puzzles with lots of near-identical messages.
+//
+// Template output is raw bytes: string values go out as they are,
+// so functions here return strings holding binary data.
+// Build a message up in a variable to take its length or digest:
+//
+//	{{$body := cat (counter "seq" | u16be) "hello"}}{{len $body | u16le}}{{$body}}{{crc32 $body | u32be}}
+//
+// Functions, besides the text/template builtins:
+//
+//	hex S            bytes from hex digits, ignoring spaces
+//	tohex S          hex digits for S
+//	cat S...         S joined together
+//	repeat N S       S, N times
+//	counter NAME     the next value of the named counter, starting at 0
+//	add A B          A + B
+//	rand N           N random bytes
+//	randn N          a random number in [0,N)
+//	u8 N             N as 1 byte
+//	u16be, u16le N   N as 2 bytes, big- or little-endian
+//	u32be, u32le N   N as 4 bytes
+//	u64be, u64le N   N as 8 bytes
+//	crc32 S          IEEE CRC-32 of S, as a number
+//	md5, sha1, sha256 S   digest of S, as bytes
+//	xor KEY S        S XORed with KEY, repeated
+package payload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"text/template"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+// Templates renders payload templates,
+// keeping counters from one payload to the next.
+type Templates struct {
+	// Counter values, by name
+	Counters map[string]uint64
+
+	// Source of random bytes; if nil, the math/rand default source is used
+	Rand *rand.Rand
+
+	// Dot, in templates: a handy place for keys and names
+	Data interface{}
+
+	cache map[string]*template.Template
+}
+
+// New returns Templates with all counters at 0
+func New(rng *rand.Rand) *Templates {
+	return &Templates{
+		Counters: make(map[string]uint64),
+		Rand:     rng,
+		cache:    make(map[string]*template.Template),
+	}
+}
+
+// toUint64 converts any integer to uint64
+func toUint64(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case int:
+		return uint64(n), nil
+	case int8:
+		return uint64(n), nil
+	case int16:
+		return uint64(n), nil
+	case int32:
+		return uint64(n), nil
+	case int64:
+		return uint64(n), nil
+	case uint:
+		return uint64(n), nil
+	case uint8:
+		return uint64(n), nil
+	case uint16:
+		return uint64(n), nil
+	case uint32:
+		return uint64(n), nil
+	case uint64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("not an integer: %v", v)
+}
+
+// integer returns a function writing a number as bytes
+func integer(put func([]byte, uint64) []byte) func(interface{}) (string, error) {
+	return func(v interface{}) (string, error) {
+		n, err := toUint64(v)
+		if err != nil {
+			return "", err
+		}
+		return string(put(nil, n)), nil
+	}
+}
+
+func (t *Templates) funcs() template.FuncMap {
+	be, le := binary.BigEndian, binary.LittleEndian
+	return template.FuncMap{
+		"hex": func(s string) (string, error) {
+			b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+			return string(b), err
+		},
+		"tohex": func(s string) string {
+			return hex.EncodeToString([]byte(s))
+		},
+		"cat": func(s ...string) string {
+			return strings.Join(s, "")
+		},
+		"repeat": func(n int, s string) string {
+			return strings.Repeat(s, n)
+		},
+		"counter": func(name string) uint64 {
+			n := t.Counters[name]
+			t.Counters[name] = n + 1
+			return n
+		},
+		"add": func(a, b interface{}) (uint64, error) {
+			x, err := toUint64(a)
+			if err != nil {
+				return 0, err
+			}
+			y, err := toUint64(b)
+			return x + y, err
+		},
+		"rand": func(n int) string {
+			b := make([]byte, n)
+			pcapwriter.Random(t.Rand).Read(b)
+			return string(b)
+		},
+		"randn": func(n int) int {
+			return pcapwriter.Random(t.Rand).Intn(n)
+		},
+		"u8":    integer(func(b []byte, n uint64) []byte { return append(b, uint8(n)) }),
+		"u16be": integer(func(b []byte, n uint64) []byte { return be.AppendUint16(b, uint16(n)) }),
+		"u16le": integer(func(b []byte, n uint64) []byte { return le.AppendUint16(b, uint16(n)) }),
+		"u32be": integer(func(b []byte, n uint64) []byte { return be.AppendUint32(b, uint32(n)) }),
+		"u32le": integer(func(b []byte, n uint64) []byte { return le.AppendUint32(b, uint32(n)) }),
+		"u64be": integer(func(b []byte, n uint64) []byte { return be.AppendUint64(b, n) }),
+		"u64le": integer(func(b []byte, n uint64) []byte { return le.AppendUint64(b, n) }),
+		"crc32": func(s string) uint32 {
+			return crc32.ChecksumIEEE([]byte(s))
+		},
+		"md5": func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return string(sum[:])
+		},
+		"sha1": func(s string) string {
+			sum := sha1.Sum([]byte(s))
+			return string(sum[:])
+		},
+		"sha256": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return string(sum[:])
+		},
+		"xor": func(key, s string) (string, error) {
+			if len(key) == 0 {
+				return "", fmt.Errorf("empty XOR key")
+			}
+			b := []byte(s)
+			for i := range b {
+				b[i] ^= key[i%len(key)]
+			}
+			return string(b), nil
+		},
+	}
+}
+
+// Render renders the template text into a payload
+func (t *Templates) Render(text string) ([]byte, error) {
+	tmpl, ok := t.cache[text]
+	if !ok {
+		var err error
+		tmpl, err = template.New("payload").Funcs(t.funcs()).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		t.cache[text] = tmpl
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, t.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
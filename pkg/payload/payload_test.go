@@ -0,0 +1,79 @@
+package payload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		text string
+		want []byte
+	}{
+		{`plain`, []byte("plain")},
+		{`{{hex "de ad be ef"}}`, []byte{0xde, 0xad, 0xbe, 0xef}},
+		{`{{u8 1}}{{u16be 0x0102}}{{u16le 0x0102}}`, []byte{1, 1, 2, 2, 1}},
+		{`{{u32le 0x01020304}}{{u64be 5}}`, []byte{4, 3, 2, 1, 0, 0, 0, 0, 0, 0, 0, 5}},
+		{`{{$b := "moo"}}{{len $b | u16be}}{{$b}}`, []byte{0, 3, 'm', 'o', 'o'}},
+		{`{{xor "\x01\x02" "abc"}}`, []byte{'a' ^ 1, 'b' ^ 2, 'c' ^ 1}},
+		{`{{repeat 3 "ab"}}`, []byte("ababab")},
+		{`{{"abc" | tohex}}`, []byte("616263")},
+		{`{{add 2 3}}`, []byte("5")},
+	}
+	for _, c := range cases {
+		got, err := New(nil).Render(c.text)
+		if err != nil {
+			t.Errorf("%s: %v", c.text, err)
+		} else if !bytes.Equal(got, c.want) {
+			t.Errorf("%s: got %q, wanted %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestDigests(t *testing.T) {
+	got, err := New(nil).Render(`{{$b := cat "hel" "lo"}}{{crc32 $b | u32be}}{{md5 $b}}{{len (sha1 $b)}} {{len (sha256 $b)}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte("hello"))
+	want := []byte{0, 0, 0, 0}
+	crc := crc32.ChecksumIEEE([]byte("hello"))
+	want[0], want[1], want[2], want[3] = byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc)
+	want = append(want, sum[:]...)
+	want = append(want, "20 32"...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, wanted %x", got, want)
+	}
+}
+
+func TestState(t *testing.T) {
+	tmpl := New(rand.New(rand.NewSource(1)))
+	for i := byte(0); i < 3; i++ {
+		got, err := tmpl.Render(`{{counter "seq" | u8}}{{counter "other" | u8}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, []byte{i, i}) {
+			t.Errorf("render %d: got %x", i, got)
+		}
+	}
+
+	a, _ := tmpl.Render(`{{rand 8}}`)
+	b, _ := tmpl.Render(`{{rand 8}}`)
+	if len(a) != 8 || bytes.Equal(a, b) {
+		t.Errorf("bad random bytes: %x, %x", a, b)
+	}
+	again, _ := New(rand.New(rand.NewSource(1))).Render(`{{rand 8}}`)
+	if !bytes.Equal(a, again) {
+		t.Error("random bytes don't follow the seed")
+	}
+
+	for _, bad := range []string{`{{`, `{{u8 "x"}}`, `{{xor "" "x"}}`, `{{hex "zz"}}`} {
+		if _, err := tmpl.Render(bad); err == nil {
+			t.Errorf("%s rendered", bad)
+		}
+	}
+}
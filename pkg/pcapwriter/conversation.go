@@ -0,0 +1,49 @@
+package pcapwriter
+
+import (
+	"io"
+)
+
+// Conversation records both sides of an exchange, without a peer on either end.
+//
+// Writes to Client() and Server() go straight to the recorder,
+// so nothing has to drain the other side.
+// Use Taps instead if you need to run live code on both ends,
+// like a real protocol implementation.
+type Conversation struct {
+	client io.Writer
+	server io.Writer
+}
+
+// NewConversation creates a Conversation recording client writes to client,
+// and server writes to server.
+func NewConversation(client io.Writer, server io.Writer) *Conversation {
+	return &Conversation{
+		client: client,
+		server: server,
+	}
+}
+
+// NewICMPv4Conversation returns a Conversation which adds ICMPv4/IPv4/Ethernet
+// headers around each Write().
+func NewICMPv4Conversation(w io.Writer, addrA uint8, addrB uint8) *Conversation {
+	cookedA, cookedB := NewICMPv4Writers(w, addrA, w, addrB)
+	return NewConversation(cookedA, cookedB)
+}
+
+// NewUDPv4Conversation returns a Conversation which adds UDP/IPv4/Ethernet
+// headers around each Write().
+func NewUDPv4Conversation(w io.Writer, addrA uint8, addrB uint8) *Conversation {
+	cookedA, cookedB := NewUDPv4Writers(w, addrA, w, addrB)
+	return NewConversation(cookedA, cookedB)
+}
+
+// Client returns a writer for messages sent by the client
+func (c *Conversation) Client() io.Writer {
+	return c.client
+}
+
+// Server returns a writer for messages sent by the server
+func (c *Conversation) Server() io.Writer {
+	return c.server
+}
@@ -0,0 +1,38 @@
+package pcapwriter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestConversation(t *testing.T) {
+	tapLog := &Log{
+		Now: time.Unix(0, 0),
+	}
+	conv := NewUDPv4Conversation(tapLog, 0x01, 0x40)
+
+	// No goroutines: these would block forever with Taps
+	fmt.Fprint(conv.Client(), "alpha")
+	fmt.Fprint(conv.Client(), "beta")
+	fmt.Fprint(conv.Server(), "gamma")
+
+	if len(tapLog.Entries) != 3 {
+		t.Fatalf("Wrong number of log entries: %d", len(tapLog.Entries))
+	}
+
+	packet := gopacket.NewPacket(tapLog.Entries[2].Data, layers.LayerTypeEthernet, gopacket.Lazy)
+	if ip := packet.NetworkLayer(); ip == nil {
+		t.Error("no network layer?")
+	} else if ip.NetworkFlow().Src().String() != "192.168.64.64" {
+		t.Error("wrong source IP")
+	}
+	if app := packet.ApplicationLayer(); app == nil {
+		t.Error("no application layer?")
+	} else if string(app.Payload()) != "gamma" {
+		t.Errorf("wrong payload: %q", app.Payload())
+	}
+}
@@ -0,0 +1,62 @@
+package pcapwriter
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Encapsulation is the layers an endpoint puts between Ethernet and IPv4,
+// outermost first: VLAN tags, then either MPLS labels or a PPPoE session.
+//
+// The zero value puts IPv4 straight into Ethernet.
+type Encapsulation struct {
+	// 802.1Q VLAN IDs, outermost first.
+	// With more than one, the outermost is an 802.1ad (QinQ) service tag.
+	VLANs []uint16
+
+	// MPLS labels, outermost first.
+	// Each label's TTL is copied from the IPv4 header, like most routers do.
+	MPLS []uint32
+
+	// PPPoE session ID; 0 means no PPPoE.
+	PPPoE uint16
+}
+
+// stack returns the EtherType for Ethernet to carry, and the layers to go after it.
+func (e *Encapsulation) stack(ttl uint8) (layers.EthernetType, []gopacket.SerializableLayer, error) {
+	var stack []gopacket.SerializableLayer
+	next := layers.EthernetTypeIPv4
+
+	switch {
+	case len(e.MPLS) > 0 && e.PPPoE != 0:
+		return 0, nil, fmt.Errorf("can't have both MPLS and PPPoE")
+	case len(e.MPLS) > 0:
+		for i, label := range e.MPLS {
+			stack = append(stack, &layers.MPLS{
+				Label:       label,
+				StackBottom: i == len(e.MPLS)-1,
+				TTL:         ttl,
+			})
+		}
+		next = layers.EthernetTypeMPLSUnicast
+	case e.PPPoE != 0:
+		stack = append(stack,
+			&layers.PPPoE{Version: 1, Type: 1, Code: layers.PPPoECodeSession, SessionId: e.PPPoE},
+			&layers.PPP{PPPType: layers.PPPTypeIPv4},
+		)
+		next = layers.EthernetTypePPPoESession
+	}
+
+	// Tags are built inside out, since each names the type of what follows it
+	for i := len(e.VLANs) - 1; i >= 0; i-- {
+		tag := &layers.Dot1Q{VLANIdentifier: e.VLANs[i], Type: next}
+		stack = append([]gopacket.SerializableLayer{tag}, stack...)
+		next = layers.EthernetTypeDot1Q
+		if i == 0 && len(e.VLANs) > 1 {
+			next = layers.EthernetTypeQinQ
+		}
+	}
+	return next, stack, nil
+}
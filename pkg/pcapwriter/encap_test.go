@@ -0,0 +1,72 @@
+package pcapwriter
+
+import (
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestEncapsulation(t *testing.T) {
+	cases := []struct {
+		name  string
+		encap Encapsulation
+		want  []gopacket.LayerType
+	}{
+		{"none", Encapsulation{}, nil},
+		{"vlan", Encapsulation{VLANs: []uint16{100}}, []gopacket.LayerType{layers.LayerTypeDot1Q}},
+		{"qinq", Encapsulation{VLANs: []uint16{100, 20}}, []gopacket.LayerType{layers.LayerTypeDot1Q, layers.LayerTypeDot1Q}},
+		{"mpls", Encapsulation{VLANs: []uint16{7}, MPLS: []uint32{16, 3000}}, []gopacket.LayerType{layers.LayerTypeDot1Q, layers.LayerTypeMPLS, layers.LayerTypeMPLS}},
+		{"pppoe", Encapsulation{PPPoE: 0x1234}, []gopacket.LayerType{layers.LayerTypePPPoE, layers.LayerTypePPP}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tapLog := new(Log)
+			a, _ := NewUDPv4Writers(tapLog, 1, tapLog, 2)
+			a.Encapsulation = c.encap
+			if _, err := a.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+
+			packet := gopacket.NewPacket(tapLog.Entries[0].Data, layers.LayerTypeEthernet, gopacket.Default)
+			if err := packet.ErrorLayer(); err != nil {
+				t.Fatal(err.Error())
+			}
+			want := append([]gopacket.LayerType{layers.LayerTypeEthernet}, c.want...)
+			want = append(want, layers.LayerTypeIPv4, layers.LayerTypeUDP, gopacket.LayerTypePayload)
+			got := packet.Layers()
+			if len(got) != len(want) {
+				t.Fatalf("got %d layers, wanted %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].LayerType() != want[i] {
+					t.Errorf("layer %d is %v, wanted %v", i, got[i].LayerType(), want[i])
+				}
+			}
+			if string(packet.ApplicationLayer().Payload()) != "hello" {
+				t.Error("wrong payload")
+			}
+		})
+	}
+
+	// Outer tags of QinQ are service tags
+	tapLog := new(Log)
+	a, _ := NewUDPv4Writers(tapLog, 1, tapLog, 2)
+	a.VLANs = []uint16{100, 20}
+	a.Write(nil)
+	frame := tapLog.Entries[0].Data
+	if frame[12] != 0x88 || frame[13] != 0xa8 || frame[16] != 0x81 || frame[17] != 0x00 {
+		t.Errorf("wrong tag types: % x", frame[12:18])
+	}
+
+	// Ethernet is left alone for the next frame
+	if a.EthernetType != layers.EthernetTypeIPv4 {
+		t.Error("EthernetType changed:", a.EthernetType)
+	}
+
+	a.VLANs = nil
+	a.MPLS, a.PPPoE = []uint32{16}, 1
+	if _, err := a.Write(nil); err == nil {
+		t.Error("MPLS and PPPoE together didn't fail")
+	}
+}
@@ -2,6 +2,28 @@ package pcapwriter
 
 import "io"
 
+// Impairment records a single write that JankyWriter dropped or deferred.
+type Impairment struct {
+	// Index of the impaired write, counting from 0
+	Write int `json:"write"`
+
+	// "drop" or "defer"
+	Kind string `json:"kind"`
+
+	// For deferrals, the number of writes it was held back
+	Delay int `json:"delay,omitempty"`
+}
+
+// NopCloser lets a Writer, such as a pcap Writer, sit under a JankyWriter.
+type NopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (NopCloser) Close() error {
+	return nil
+}
+
 // JankyWriter provides a mechanisms for dropping and reordering writes
 type JankyWriter struct {
 	io.WriteCloser
@@ -9,6 +31,12 @@ type JankyWriter struct {
 	dropsLeft  int
 	deferUntil int
 	deferrals  []deferral
+
+	// Every drop and deferral, in order
+	Impairments []Impairment
+
+	// If set, called when a deferred write finally goes out
+	Flushed func(Impairment)
 }
 
 // NewJankyWriter wraps w with a JankyWriter.
@@ -36,6 +64,9 @@ func (s *JankyWriter) Flush() (n int, err error) {
 	for _, deferral := range s.deferrals {
 		if s.frameno > deferral.until {
 			n, err = s.WriteCloser.Write(deferral.p)
+			if err == nil && s.Flushed != nil {
+				s.Flushed(s.Impairments[deferral.imp])
+			}
 		} else {
 			newdeferrals = append(newdeferrals, deferral)
 		}
@@ -49,10 +80,12 @@ func (w *JankyWriter) Write(p []byte) (int, error) {
 
 	if w.dropsLeft > 0 {
 		w.dropsLeft -= 1
+		w.Impairments = append(w.Impairments, Impairment{Write: w.frameno, Kind: "drop"})
 	} else if w.deferUntil > 0 {
 		buf := make([]byte, len(p))
 		copy(buf, p)
-		w.deferrals = append(w.deferrals, deferral{w.deferUntil, buf})
+		w.deferrals = append(w.deferrals, deferral{w.deferUntil, buf, len(w.Impairments)})
+		w.Impairments = append(w.Impairments, Impairment{Write: w.frameno, Kind: "defer", Delay: w.deferUntil - w.frameno})
 		w.deferUntil = 0
 	} else {
 		if n, err := w.WriteCloser.Write(p); err != nil {
@@ -63,6 +96,14 @@ func (w *JankyWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Impaired returns the impairment applied to the most recent write, or nil.
+func (w *JankyWriter) Impaired() *Impairment {
+	if n := len(w.Impairments); n > 0 && w.Impairments[n-1].Write == w.frameno-1 {
+		return &w.Impairments[n-1]
+	}
+	return nil
+}
+
 func (w *JankyWriter) Close() (err error) {
 	for len(w.deferrals) > 0 {
 		_, err = w.Flush()
@@ -41,6 +41,11 @@ func TestJankyDeferrals(t *testing.T) {
 	if output.String() != "132" {
 		t.Fatal("deferred write failed:", output.String())
 	}
+	if len(w.Impairments) != 1 {
+		t.Fatal("wrong number of impairments:", w.Impairments)
+	} else if i := w.Impairments[0]; i.Write != 1 || i.Kind != "defer" || i.Delay != 1 {
+		t.Error("wrong impairment:", i)
+	}
 }
 
 func TestJankyDrops(t *testing.T) {
@@ -50,7 +55,13 @@ func TestJankyDrops(t *testing.T) {
 	fmt.Fprint(w, "1")
 	w.Drop(1)
 	fmt.Fprint(w, "2")
+	if i := w.Impaired(); i == nil || i.Kind != "drop" {
+		t.Error("drop not reported:", i)
+	}
 	fmt.Fprint(w, "3")
+	if i := w.Impaired(); i != nil {
+		t.Error("spurious impairment:", i)
+	}
 	w.Close()
 
 	if output.String() != "13" {
@@ -11,10 +11,14 @@ import (
 type IPv4Base struct {
 	io.Writer
 	layers.Ethernet
+	Encapsulation
 	layers.IPv4
 }
 
 // PopulateBase the packet with some standard values
+//
+// saddr and daddr are host numbers: host n is at 192.168.n.n,
+// with MAC address 00:00:n:n:n:n.
 func (b *IPv4Base) PopulateBase(saddr, daddr uint8) {
 	b.EthernetType = layers.EthernetTypeIPv4
 	b.SrcMAC = net.HardwareAddr{0, 0, saddr, saddr, saddr, saddr}
@@ -37,7 +41,15 @@ func (b *IPv4Base) WritePacket(layers ...gopacket.SerializableLayer) (int, error
 		FixLengths:       true,
 		ComputeChecksums: true,
 	}
-	allLayers := append([]gopacket.SerializableLayer{&b.Ethernet, &b.IPv4}, layers...)
+	eth := b.Ethernet
+	etherType, encap, err := b.Encapsulation.stack(b.TTL)
+	if err != nil {
+		return 0, err
+	}
+	eth.EthernetType = etherType
+	allLayers := append([]gopacket.SerializableLayer{&eth}, encap...)
+	allLayers = append(allLayers, &b.IPv4)
+	allLayers = append(allLayers, layers...)
 	if err := gopacket.SerializeLayers(buf, opts, allLayers...); err != nil {
 		return 0, err
 	}
@@ -80,7 +92,8 @@ func (t *ICMPv4Writer) Write(p []byte) (int, error) {
 // NewICMPv4Taps returns two taps which add ICMPv4/IPv4/Ethernet headers around
 // each Write() sent to the tap.
 //
-// This is probably what you want if you are writing to a PCAP file.
+// Both taps must be drained by readers, or writes will block forever.
+// If you are only writing to a PCAP file, NewICMPv4Conversation is simpler.
 func NewICMPv4Taps(w io.Writer, addrA uint8, addrB uint8) (*Tap, *Tap) {
 	cookedA, cookedB := NewICMPv4Writers(w, addrA, w, addrB)
 	return NewTaps(cookedA, cookedB)
@@ -124,7 +137,8 @@ func (t *UDPv4Writer) Write(p []byte) (int, error) {
 // NewUDPv4Taps returns two taps which add UDP/IPv4/Ethernet headers around
 // each Write() sent to the tap.
 //
-// This is probably what you want if you are writing to a PCAP file.
+// Both taps must be drained by readers, or writes will block forever.
+// If you are only writing to a PCAP file, NewUDPv4Conversation is simpler.
 func NewUDPv4Taps(w io.Writer, addrA uint8, addrB uint8) (*Tap, *Tap) {
 	cookedA, cookedB := NewUDPv4Writers(w, addrA, w, addrB)
 	return NewTaps(cookedA, cookedB)
@@ -4,6 +4,7 @@ package pcapwriter
 
 import (
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math/rand"
 	"time"
@@ -25,6 +26,38 @@ type Writer struct {
 
 	// Upper limit on random time to add to each successive packet
 	Jitter time.Duration
+
+	// Source of jitter; if nil, the math/rand default source is used
+	Rand *rand.Rand
+
+	// Number of frames written so far.
+	// This is also the Wireshark frame number of the last frame written.
+	Frames int
+}
+
+// defaultSource draws from the math/rand default source
+type defaultSource struct{}
+
+func (defaultSource) Int63() int64   { return rand.Int63() }
+func (defaultSource) Uint64() uint64 { return rand.Uint64() }
+func (defaultSource) Seed(int64)     {}
+
+// Random returns r, or if r is nil, a Rand drawing from the math/rand default source.
+//
+// Use it for the Rand fields found throughout pcapgen, which may be left nil.
+func Random(r *rand.Rand) *rand.Rand {
+	if r != nil {
+		return r
+	}
+	return rand.New(defaultSource{})
+}
+
+// SubSeed derives a seed for one consumer of randomness, called name,
+// so consumers sharing a seed don't all draw the same numbers.
+func SubSeed(seed int64, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return seed ^ int64(h.Sum64())
 }
 
 // Sleep advances the internal clock by exactly d
@@ -42,9 +75,10 @@ func (pw *Writer) Write(frame []byte) (int, error) {
 	if err := pw.Writer.WritePacket(ci, frame); err != nil {
 		return 0, err
 	}
+	pw.Frames += 1
 
 	if pw.Jitter > 0 {
-		pw.Sleep(time.Duration(rand.Int63n(int64(pw.Jitter))))
+		pw.Sleep(time.Duration(Random(pw.Rand).Int63n(int64(pw.Jitter))))
 	}
 
 	return len(frame), nil
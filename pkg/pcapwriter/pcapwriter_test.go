@@ -2,6 +2,7 @@ package pcapwriter
 
 import (
 	"bytes"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -76,4 +77,27 @@ func TestWrite(t *testing.T) {
 	if jitterProblems > 0 {
 		t.Error("Timestamps outside of lag+jitter window:", jitterProblems)
 	}
+	if w.Frames != 80 {
+		t.Error("Wrong frame count:", w.Frames)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	if Random(r) != r {
+		t.Error("Random replaced a Rand")
+	}
+	if n := Random(nil).Intn(10); n < 0 || n >= 10 {
+		t.Error("default source out of range:", n)
+	}
+}
+
+func TestSubSeed(t *testing.T) {
+	noise, payload := SubSeed(1, "noise"), SubSeed(1, "payload")
+	if noise == 1 || payload == 1 || noise == payload {
+		t.Error("sub-seeds collide:", noise, payload)
+	}
+	if SubSeed(1, "noise") != noise {
+		t.Error("sub-seed not repeatable")
+	}
 }
@@ -1,12 +1,15 @@
 package pcapwriter
 
 import (
+	"bytes"
 	"io"
+	"sync"
 )
 
 type deferral struct {
 	until int
 	p     []byte
+	imp   int
 }
 
 // Tap passes bytes between endpoints, additionally writing everything
@@ -68,3 +71,97 @@ func NewTaps(tapA io.Writer, tapB io.Writer) (*Tap, *Tap) {
 	}
 	return &abSocket, &baSocket
 }
+
+// bufferedPipe is a pipe whose writes never wait for a reader.
+type bufferedPipe struct {
+	mu      *sync.Mutex
+	cond    *sync.Cond
+	buf     bytes.Buffer
+	wclosed bool
+	rclosed bool
+}
+
+// bufferedPipeReader is the read half of a bufferedPipe
+type bufferedPipeReader struct {
+	*bufferedPipe
+}
+
+func (r bufferedPipeReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.buf.Len() == 0 {
+		if r.rclosed {
+			return 0, io.ErrClosedPipe
+		}
+		if r.wclosed {
+			return 0, io.EOF
+		}
+		r.cond.Wait()
+	}
+	return r.buf.Read(p)
+}
+
+func (r bufferedPipeReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rclosed = true
+	r.cond.Broadcast()
+	return nil
+}
+
+// bufferedPipeWriter is the write half of a bufferedPipe.
+//
+// Each write is recorded to tap before the reader can see it.
+type bufferedPipeWriter struct {
+	*bufferedPipe
+	tap io.Writer
+}
+
+func (w bufferedPipeWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wclosed || w.rclosed {
+		return 0, io.ErrClosedPipe
+	}
+	if n, err := w.tap.Write(p); err != nil {
+		return n, err
+	}
+	w.buf.Write(p)
+	w.cond.Broadcast()
+	return len(p), nil
+}
+
+func (w bufferedPipeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wclosed = true
+	w.cond.Broadcast()
+	return nil
+}
+
+// NewBufferedTaps is like NewTaps, but writes never wait for the peer to read.
+//
+// This lets each end run in its own goroutine,
+// even when both ends write at the same time, as TLS does.
+// Recording is serialized between the two taps,
+// and each write is recorded before the peer can read it,
+// so the capture reads in causal order.
+func NewBufferedTaps(tapA io.Writer, tapB io.Writer) (*Tap, *Tap) {
+	mu := new(sync.Mutex)
+	cond := sync.NewCond(mu)
+	ab := &bufferedPipe{mu: mu, cond: cond}
+	ba := &bufferedPipe{mu: mu, cond: cond}
+
+	// The pipe writers do the recording
+	abSocket := Tap{
+		PeerReader: bufferedPipeReader{ba},
+		PeerWriter: bufferedPipeWriter{ab, tapA},
+		Tap:        io.Discard,
+	}
+	baSocket := Tap{
+		PeerReader: bufferedPipeReader{ab},
+		PeerWriter: bufferedPipeWriter{ba, tapB},
+		Tap:        io.Discard,
+	}
+	return &abSocket, &baSocket
+}
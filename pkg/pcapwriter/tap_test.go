@@ -108,3 +108,41 @@ func TestUDPSocketSingle(t *testing.T) {
 	alice.Close()
 	bob.Close()
 }
+
+func TestBufferedTaps(t *testing.T) {
+	tapLog := new(Log)
+	alice, bob := NewBufferedTaps(tapLog, tapLog)
+
+	// Both write before either reads: this would deadlock with NewTaps
+	if _, err := alice.Write([]byte("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Write([]byte("beta")); err != nil {
+		t.Fatal(err)
+	}
+	alice.CloseWrite()
+
+	buf := make([]byte, 40)
+	if n, err := bob.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if string(buf[:n]) != "alpha" {
+		t.Errorf("bad read: got %q", buf[:n])
+	}
+	if _, err := bob.Read(buf); err != io.EOF {
+		t.Error("no EOF after CloseWrite:", err)
+	}
+	if n, err := alice.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if string(buf[:n]) != "beta" {
+		t.Errorf("bad read: got %q", buf[:n])
+	}
+
+	if len(tapLog.Entries) != 2 {
+		t.Fatal("wrong number of log entries:", len(tapLog.Entries))
+	}
+	if string(tapLog.Entries[0].Data) != "alpha" || string(tapLog.Entries[1].Data) != "beta" {
+		t.Error("recorded in wrong order:", tapLog.String())
+	}
+	alice.Close()
+	bob.Close()
+}
@@ -0,0 +1,200 @@
+package pcapwriter
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// DefaultMSS is the largest segment payload for a 1500-byte Ethernet MTU
+const DefaultMSS = 1460
+
+// TCPv4Writer wraps each Write() with TCP/IPv4/Ethernet headers,
+// splitting it into MSS-sized segments,
+// and keeping sequence and acknowledgement numbers in step with Peer.
+// Peer acknowledges every two full segments,
+// and whenever another segment wouldn't fit in its Window.
+//
+// The first Write() on either side performs the three-way handshake,
+// initiated by whichever side wrote first.
+type TCPv4Writer struct {
+	IPv4Base
+	layers.TCP
+
+	// The other end of the connection
+	Peer *TCPv4Writer
+
+	// Largest segment payload
+	MSS int
+
+	established bool
+	closed      bool
+
+	// Bytes sent that Peer hasn't acknowledged yet
+	unacked int
+}
+
+// NewTCPv4Writers creates two new default-configured TCPv4 writers,
+// connected to each other.
+//
+// This uses some reasonable defaults for each packet, with MAC addresses
+// 00:00:aa:aa:aa:aa and 00:00:bb:bb:bb:bb, IP addresses 192.168.a.a and
+// 192.168.b.b, and ports a and b.
+func NewTCPv4Writers(writerA io.Writer, addrA uint8, writerB io.Writer, addrB uint8) (*TCPv4Writer, *TCPv4Writer) {
+	a := new(TCPv4Writer)
+	a.Writer = writerA
+	a.Protocol = layers.IPProtocolTCP
+	a.PopulateBase(addrA, addrB)
+	a.SrcPort = layers.TCPPort(addrA)
+	a.DstPort = layers.TCPPort(addrB)
+	a.Seq = uint32(addrA) * 0x01010101
+	a.Window = 65535
+	a.MSS = DefaultMSS
+	a.SetNetworkLayerForChecksum(&a.IPv4)
+
+	b := new(TCPv4Writer)
+	b.Writer = writerB
+	b.Protocol = layers.IPProtocolTCP
+	b.PopulateBase(addrB, addrA)
+	b.SrcPort = layers.TCPPort(addrB)
+	b.DstPort = layers.TCPPort(addrA)
+	b.Seq = uint32(addrB) * 0x01010101
+	b.Window = 65535
+	b.MSS = DefaultMSS
+	b.SetNetworkLayerForChecksum(&b.IPv4)
+
+	a.Peer = b
+	b.Peer = a
+	return a, b
+}
+
+// segment writes one segment with the given flags and payload,
+// advancing Seq.
+func (t *TCPv4Writer) segment(syn, fin, rst bool, p []byte) (int, error) {
+	t.SYN, t.FIN, t.RST = syn, fin, rst
+	// Only the opening SYN has nothing to acknowledge
+	t.ACK = !syn || t.Ack != 0
+	t.PSH = len(p) > 0
+	t.Options = nil
+	if syn {
+		mss := binary.BigEndian.AppendUint16(nil, uint16(t.MSS))
+		t.Options = []layers.TCPOption{{OptionType: layers.TCPOptionKindMSS, OptionData: mss}}
+	}
+
+	n, err := t.WritePacket(&t.TCP, gopacket.Payload(p))
+	t.Seq += uint32(len(p))
+	if syn || fin {
+		t.Seq += 1
+	}
+	t.Peer.Ack = t.Seq
+	t.unacked += len(p)
+	t.Peer.unacked = 0
+	return n, err
+}
+
+// Connect performs a three-way handshake, with t as the client.
+//
+// Write() calls this automatically if the connection isn't up yet.
+func (t *TCPv4Writer) Connect() error {
+	t.Ack = 0
+	if _, err := t.segment(true, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := t.Peer.segment(true, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := t.segment(false, false, false, nil); err != nil {
+		return err
+	}
+	t.established = true
+	t.Peer.established = true
+	return nil
+}
+
+func (t *TCPv4Writer) Write(p []byte) (int, error) {
+	if t.closed {
+		return 0, net.ErrClosed
+	}
+	if !t.established {
+		if err := t.Connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > t.MSS {
+			n = t.MSS
+		}
+		if window := int(t.Peer.Window); n > window && window > 0 {
+			n = window
+		}
+		if t.unacked > 0 && t.unacked+n > int(t.Peer.Window) {
+			if err := t.Peer.AckPeer(); err != nil {
+				return written, err
+			}
+		}
+		if _, err := t.segment(false, false, false, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		if t.unacked >= 2*t.MSS {
+			if err := t.Peer.AckPeer(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// AckPeer sends a bare acknowledgement of everything Peer has sent.
+func (t *TCPv4Writer) AckPeer() error {
+	_, err := t.segment(false, false, false, nil)
+	return err
+}
+
+// Close sends a FIN, which Peer acknowledges.
+//
+// Call Close on both sides for an orderly shutdown.
+func (t *TCPv4Writer) Close() error {
+	if t.closed || !t.established {
+		return nil
+	}
+	t.closed = true
+	if _, err := t.segment(false, true, false, nil); err != nil {
+		return err
+	}
+	return t.Peer.AckPeer()
+}
+
+// Reset sends a RST, aborting the connection.
+func (t *TCPv4Writer) Reset() error {
+	t.closed = true
+	t.Peer.closed = true
+	_, err := t.segment(false, false, true, nil)
+	return err
+}
+
+// NewTCPv4Taps returns two taps which add TCP/IPv4/Ethernet headers around
+// each Write() sent to the tap.
+//
+// Both taps must be drained by readers, or writes will block forever.
+// If you are only writing to a PCAP file, NewTCPv4Conversation is simpler.
+func NewTCPv4Taps(w io.Writer, addrA uint8, addrB uint8) (*Tap, *Tap) {
+	cookedA, cookedB := NewTCPv4Writers(w, addrA, w, addrB)
+	return NewTaps(cookedA, cookedB)
+}
+
+// NewTCPv4Conversation returns a Conversation which adds TCP/IPv4/Ethernet
+// headers around each Write().
+//
+// The client is the side that connects.
+func NewTCPv4Conversation(w io.Writer, addrA uint8, addrB uint8) *Conversation {
+	cookedA, cookedB := NewTCPv4Writers(w, addrA, w, addrB)
+	return NewConversation(cookedA, cookedB)
+}
@@ -0,0 +1,109 @@
+package pcapwriter
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func decodeTCP(t *testing.T, frame []byte) *layers.TCP {
+	t.Helper()
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		t.Fatal("no TCP layer")
+	}
+	return tcp
+}
+
+func TestTCPConversation(t *testing.T) {
+	tapLog := new(Log)
+	conv := NewTCPv4Conversation(tapLog, 0x01, 0x40)
+	cli := conv.Client().(*TCPv4Writer)
+	srv := conv.Server().(*TCPv4Writer)
+	cli.MSS = 10
+
+	request := []byte("GET / HTTP/1.0\r\n\r\n")
+	if n, err := cli.Write(request); err != nil {
+		t.Fatal(err)
+	} else if n != len(request) {
+		t.Error("short write:", n)
+	}
+	srv.Write([]byte("moo"))
+	cli.Close()
+	srv.Close()
+
+	// SYN, SYN/ACK, ACK, 2 request segments, response, FIN, ACK, FIN, ACK
+	if len(tapLog.Entries) != 10 {
+		t.Fatal("wrong number of frames:", len(tapLog.Entries))
+	}
+
+	syn := decodeTCP(t, tapLog.Entries[0].Data)
+	synack := decodeTCP(t, tapLog.Entries[1].Data)
+	ack := decodeTCP(t, tapLog.Entries[2].Data)
+	if !syn.SYN || syn.ACK || !synack.SYN || !synack.ACK || ack.SYN || !ack.ACK {
+		t.Error("wrong handshake flags")
+	}
+	if synack.Ack != syn.Seq+1 || ack.Ack != synack.Seq+1 || ack.Seq != syn.Seq+1 {
+		t.Error("wrong handshake sequence numbers")
+	}
+
+	seg1 := decodeTCP(t, tapLog.Entries[3].Data)
+	seg2 := decodeTCP(t, tapLog.Entries[4].Data)
+	if !bytes.Equal(append(seg1.Payload, seg2.Payload...), request) {
+		t.Errorf("wrong segments: %q %q", seg1.Payload, seg2.Payload)
+	}
+	if seg2.Seq != seg1.Seq+10 {
+		t.Error("wrong second segment sequence number")
+	}
+
+	resp := decodeTCP(t, tapLog.Entries[5].Data)
+	if resp.Ack != seg2.Seq+uint32(len(seg2.Payload)) {
+		t.Error("response doesn't acknowledge request")
+	}
+	if fin := decodeTCP(t, tapLog.Entries[6].Data); !fin.FIN || fin.Ack != resp.Seq+3 {
+		t.Error("wrong FIN")
+	}
+	if last := decodeTCP(t, tapLog.Entries[9].Data); !last.ACK || last.FIN {
+		t.Error("wrong final ACK")
+	}
+
+	if _, err := cli.Write([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Error("write after close:", err)
+	}
+	if len(tapLog.Entries) != 10 {
+		t.Error("segment sent after close")
+	}
+}
+
+func TestTCPAcks(t *testing.T) {
+	for _, window := range []uint16{65535, 4000, 1000} {
+		tapLog := new(Log)
+		cli, srv := NewTCPv4Writers(tapLog, 0x01, tapLog, 0x40)
+		srv.Window = window
+		body := make([]byte, 200*1024)
+		if _, err := cli.Write(body); err != nil {
+			t.Fatal(err)
+		}
+
+		var sent, acked uint32
+		for _, e := range tapLog.Entries {
+			tcp := decodeTCP(t, e.Data)
+			if tcp.SrcPort == cli.SrcPort {
+				sent = tcp.Seq + uint32(len(tcp.Payload))
+				if tcp.SYN {
+					sent += 1
+				}
+			} else {
+				acked = tcp.Ack
+			}
+			if acked != 0 && sent-acked > uint32(window) {
+				t.Fatalf("window %d: %d bytes unacknowledged", window, sent-acked)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pcapwriter
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// TimingChannel hides a secret in the gaps between frames.
+//
+// Each gap encodes one symbol: with two gaps, a short gap is a 0 bit and a
+// long gap is a 1; with four gaps, each gap carries two bits, and so on.
+// Bits are sent most significant first.
+// Once the secret has been sent, frames pass through on the usual clock.
+// Until then, Write sets the clock itself, so any Sleep in between is lost.
+type TimingChannel struct {
+	w     io.Writer
+	clock *Writer
+
+	// Gap for each symbol value
+	Gaps []time.Duration
+
+	// Upper limit on random time to add to each gap.
+	// Keep it under half the difference between gaps, or DecodeGaps gets confused.
+	Jitter time.Duration
+
+	// Source of jitter; if nil, the math/rand default source is used
+	Rand *rand.Rand
+
+	symbols []int
+	last    time.Time
+}
+
+// bitsPerSymbol returns log2(n), or an error if n isn't a power of 2 above 1
+func bitsPerSymbol(n int) (int, error) {
+	bits := 0
+	for v := n; v > 1; v >>= 1 {
+		if v&1 != 0 {
+			return 0, fmt.Errorf("number of gaps must be a power of 2, not %d", n)
+		}
+		bits += 1
+	}
+	if bits == 0 {
+		return 0, fmt.Errorf("need at least 2 gaps")
+	}
+	return bits, nil
+}
+
+// NewTimingChannel returns a TimingChannel sending secret
+// in the gaps between frames written to w.
+//
+// clock is the Writer whose timestamps are modulated;
+// usually w is clock too.
+func NewTimingChannel(w io.Writer, clock *Writer, secret []byte, gaps ...time.Duration) (*TimingChannel, error) {
+	bits, err := bitsPerSymbol(len(gaps))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TimingChannel{
+		w:     w,
+		clock: clock,
+		Gaps:  gaps,
+	}
+	sym, n := 0, 0
+	for _, b := range secret {
+		for i := 7; i >= 0; i-- {
+			sym = sym<<1 | int(b>>uint(i)&1)
+			n += 1
+			if n == bits {
+				t.symbols = append(t.symbols, sym)
+				sym, n = 0, 0
+			}
+		}
+	}
+	if n > 0 {
+		t.symbols = append(t.symbols, sym<<uint(bits-n))
+	}
+	return t, nil
+}
+
+// Remaining returns how many more frames it takes to send the rest of the secret
+func (t *TimingChannel) Remaining() int {
+	if len(t.symbols) == 0 {
+		return 0
+	}
+	if t.last.IsZero() {
+		// The first frame only marks the start
+		return len(t.symbols) + 1
+	}
+	return len(t.symbols)
+}
+
+// Write writes frame, timestamped to encode the next symbol
+func (t *TimingChannel) Write(frame []byte) (int, error) {
+	if !t.last.IsZero() && len(t.symbols) > 0 {
+		gap := t.Gaps[t.symbols[0]]
+		t.symbols = t.symbols[1:]
+		if t.Jitter > 0 {
+			gap += time.Duration(Random(t.Rand).Int63n(int64(t.Jitter)))
+		}
+		t.clock.Now = t.last.Add(gap)
+	}
+	t.last = t.clock.Now
+	return t.w.Write(frame)
+}
+
+// DecodeGaps recovers a secret from frame timestamps,
+// taking each gap as the symbol whose gap it's closest to.
+//
+// Trailing bits that don't make up a whole byte are dropped.
+func DecodeGaps(times []time.Time, gaps ...time.Duration) ([]byte, error) {
+	bits, err := bitsPerSymbol(len(gaps))
+	if err != nil {
+		return nil, err
+	}
+
+	var secret []byte
+	acc, n := 0, 0
+	for i := 1; i < len(times); i++ {
+		d := times[i].Sub(times[i-1])
+		best := 0
+		for sym, g := range gaps {
+			if abs(d-g) < abs(d-gaps[best]) {
+				best = sym
+			}
+		}
+		for j := bits - 1; j >= 0; j-- {
+			acc = acc<<1 | best>>uint(j)&1
+			n += 1
+			if n == 8 {
+				secret = append(secret, byte(acc))
+				acc, n = 0, 0
+			}
+		}
+	}
+	return secret, nil
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
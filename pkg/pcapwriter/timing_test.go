@@ -0,0 +1,72 @@
+package pcapwriter
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestTimingChannel(t *testing.T) {
+	secret := []byte("moo!")
+	cases := [][]time.Duration{
+		{100 * time.Millisecond, 300 * time.Millisecond},
+		{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond},
+	}
+	for _, gaps := range cases {
+		buf := new(bytes.Buffer)
+		pcap, err := NewWriter(buf, time.Unix(1000, 0), 50*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcap.Rand = rand.New(rand.NewSource(1))
+		pcap.WriteStandardHeader()
+
+		tc, err := NewTimingChannel(pcap, pcap, secret, gaps...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.Jitter = gaps[0] / 3
+		tc.Rand = rand.New(rand.NewSource(1))
+		conv := NewUDPv4Conversation(tc, 0x01, 0x40)
+
+		// Payloads are decoys; sleeps don't matter while the secret is going out
+		frames := tc.Remaining()
+		for i := 0; i < frames; i++ {
+			conv.Client().Write([]byte("decoy"))
+			pcap.Sleep(time.Hour)
+		}
+		if tc.Remaining() != 0 {
+			t.Fatal("secret not sent")
+		}
+
+		r, err := pcapgo.NewReader(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var times []time.Time
+		for {
+			_, ci, err := r.ReadPacketData()
+			if err != nil {
+				break
+			}
+			times = append(times, ci.Timestamp)
+		}
+		if len(times) != frames {
+			t.Fatal("wrong number of frames:", len(times))
+		}
+		got, err := DecodeGaps(times, gaps...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("%d gaps: decoded %q", len(gaps), got)
+		}
+	}
+
+	if _, err := NewTimingChannel(nil, nil, secret, time.Second, 2*time.Second, 3*time.Second); err == nil {
+		t.Error("3 gaps accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package pcapwriter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// TunnelKind is a tunneling protocol
+type TunnelKind int
+
+// Tunneling protocols
+const (
+	// GRE carries the inner IP packet, IP protocol 47
+	TunnelGRE TunnelKind = iota
+
+	// VXLAN carries the whole inner Ethernet frame, over UDP port 4789
+	TunnelVXLAN
+
+	// IP-in-IP carries the inner IP packet, IP protocol 4
+	TunnelIPIP
+
+	// GTP-U carries the inner IP packet, over UDP port 2152
+	TunnelGTP
+)
+
+// Well-known tunnel ports
+const (
+	VXLANPort = 4789
+	GTPPort   = 2152
+)
+
+var tunnelNames = map[string]TunnelKind{
+	"gre":   TunnelGRE,
+	"vxlan": TunnelVXLAN,
+	"ipip":  TunnelIPIP,
+	"gtp":   TunnelGTP,
+}
+
+// ParseTunnelKind returns the TunnelKind called name: gre, vxlan, ipip, or gtp
+func ParseTunnelKind(name string) (TunnelKind, error) {
+	k, ok := tunnelNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown tunnel: %q", name)
+	}
+	return k, nil
+}
+
+// Tunnel wraps each Ethernet frame written to it in an outer tunnel,
+// addressed by IPv4Base.
+//
+// Point any writer at a Tunnel, and a Tunnel at another Tunnel,
+// to bury a conversation as deep as you like.
+type Tunnel struct {
+	IPv4Base
+	layers.UDP
+	Kind TunnelKind
+
+	// GRE key, VXLAN network identifier, or GTP tunnel endpoint identifier.
+	// A GRE key of 0 leaves the key out.
+	ID uint32
+}
+
+// NewTunnels creates a pair of tunnel endpoints, for each direction.
+//
+// Outer addresses follow the conventions of NewUDPv4Writers.
+func NewTunnels(writerA io.Writer, addrA uint8, writerB io.Writer, addrB uint8, kind TunnelKind) (*Tunnel, *Tunnel) {
+	a := &Tunnel{Kind: kind}
+	a.Writer = writerA
+	a.PopulateBase(addrA, addrB)
+
+	b := &Tunnel{Kind: kind}
+	b.Writer = writerB
+	b.PopulateBase(addrB, addrA)
+
+	for _, t := range []*Tunnel{a, b} {
+		switch kind {
+		case TunnelGRE:
+			t.Protocol = layers.IPProtocolGRE
+		case TunnelIPIP:
+			t.Protocol = layers.IPProtocolIPv4
+		case TunnelVXLAN:
+			t.Protocol = layers.IPProtocolUDP
+			t.DstPort = VXLANPort
+		case TunnelGTP:
+			t.Protocol = layers.IPProtocolUDP
+			t.SrcPort, t.DstPort = GTPPort, GTPPort
+		}
+		t.SetNetworkLayerForChecksum(&t.IPv4)
+	}
+	return a, b
+}
+
+// innerIP returns the IPv4 packet inside frame
+func innerIP(frame []byte) ([]byte, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	offset := 0
+	for _, l := range packet.Layers() {
+		if l.LayerType() == layers.LayerTypeIPv4 {
+			end := offset + len(l.LayerContents()) + len(l.LayerPayload())
+			return frame[offset:end], nil
+		}
+		offset += len(l.LayerContents())
+	}
+	return nil, fmt.Errorf("no IPv4 packet to tunnel")
+}
+
+// Write wraps frame and writes it out
+func (t *Tunnel) Write(frame []byte) (int, error) {
+	var wrapped []gopacket.SerializableLayer
+	if t.Kind == TunnelVXLAN {
+		// Like most VTEPs, pick the source port from a hash of the inner frame's headers
+		h := fnv.New32a()
+		if len(frame) > 34 {
+			h.Write(frame[:34])
+		} else {
+			h.Write(frame)
+		}
+		t.SrcPort = layers.UDPPort(49152 + h.Sum32()%16384)
+		wrapped = []gopacket.SerializableLayer{&t.UDP, &layers.VXLAN{ValidIDFlag: true, VNI: t.ID}, gopacket.Payload(frame)}
+	} else {
+		ip, err := innerIP(frame)
+		if err != nil {
+			return 0, err
+		}
+		switch t.Kind {
+		case TunnelGRE:
+			gre := &layers.GRE{Protocol: layers.EthernetTypeIPv4, KeyPresent: t.ID != 0, Key: t.ID}
+			wrapped = []gopacket.SerializableLayer{gre, gopacket.Payload(ip)}
+		case TunnelIPIP:
+			wrapped = []gopacket.SerializableLayer{gopacket.Payload(ip)}
+		case TunnelGTP:
+			// A T-PDU, carrying user traffic
+			gtp := &layers.GTPv1U{Version: 1, ProtocolType: 1, MessageType: 255, MessageLength: uint16(len(ip)), TEID: t.ID}
+			wrapped = []gopacket.SerializableLayer{&t.UDP, gtp, gopacket.Payload(ip)}
+		default:
+			return 0, fmt.Errorf("unknown tunnel kind: %d", t.Kind)
+		}
+	}
+	if _, err := t.WritePacket(wrapped...); err != nil {
+		return 0, err
+	}
+	return len(frame), nil
+}
@@ -0,0 +1,76 @@
+package pcapwriter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestTunnel(t *testing.T) {
+	cases := []struct {
+		kind TunnelKind
+		want []gopacket.LayerType
+	}{
+		{TunnelGRE, []gopacket.LayerType{layers.LayerTypeGRE}},
+		{TunnelIPIP, nil},
+		{TunnelVXLAN, []gopacket.LayerType{layers.LayerTypeUDP, layers.LayerTypeVXLAN, layers.LayerTypeEthernet}},
+		{TunnelGTP, []gopacket.LayerType{layers.LayerTypeUDP, layers.LayerTypeGTPv1U}},
+	}
+	for _, c := range cases {
+		tapLog := new(Log)
+		outer, _ := NewTunnels(tapLog, 1, tapLog, 2, c.kind)
+		outer.ID = 42
+		outer.SrcIP = net.IPv4(10, 0, 0, 1)
+		inner, _ := NewUDPv4Writers(outer, 3, outer, 4)
+		if _, err := inner.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		packet := gopacket.NewPacket(tapLog.Entries[0].Data, layers.LayerTypeEthernet, gopacket.Default)
+		if err := packet.ErrorLayer(); err != nil {
+			t.Fatal(c.kind, err.Error())
+		}
+		want := []gopacket.LayerType{layers.LayerTypeEthernet, layers.LayerTypeIPv4}
+		want = append(want, c.want...)
+		want = append(want, layers.LayerTypeIPv4, layers.LayerTypeUDP, gopacket.LayerTypePayload)
+		got := packet.Layers()
+		if len(got) != len(want) {
+			t.Fatalf("kind %d: got %d layers, wanted %d", c.kind, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].LayerType() != want[i] {
+				t.Errorf("kind %d: layer %d is %v, wanted %v", c.kind, i, got[i].LayerType(), want[i])
+			}
+		}
+
+		ips := []*layers.IPv4{}
+		for _, l := range got {
+			if ip, ok := l.(*layers.IPv4); ok {
+				ips = append(ips, ip)
+			}
+		}
+		if !ips[0].SrcIP.Equal(net.IPv4(10, 0, 0, 1)) || !ips[1].SrcIP.Equal(net.IPv4(192, 168, 3, 3)) {
+			t.Errorf("kind %d: wrong addresses %v, %v", c.kind, ips[0].SrcIP, ips[1].SrcIP)
+		}
+		if string(packet.ApplicationLayer().Payload()) != "hello" {
+			t.Errorf("kind %d: wrong payload", c.kind)
+		}
+	}
+
+	// Tunnels nest
+	tapLog := new(Log)
+	outer, _ := NewTunnels(tapLog, 1, tapLog, 2, TunnelVXLAN)
+	middle, _ := NewTunnels(outer, 3, outer, 4, TunnelGRE)
+	inner, _ := NewICMPv4Writers(middle, 5, middle, 6)
+	inner.Write([]byte("deep"))
+	packet := gopacket.NewPacket(tapLog.Entries[0].Data, layers.LayerTypeEthernet, gopacket.Default)
+	if packet.Layer(layers.LayerTypeICMPv4) == nil {
+		t.Error("no ICMP at the bottom:", packet)
+	}
+
+	if _, err := ParseTunnelKind("ipsec"); err == nil {
+		t.Error("unknown tunnel kind parsed")
+	}
+}
@@ -0,0 +1,170 @@
+package recon
+
+import (
+	"bytes"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func capture(t *testing.T) (*pcapwriter.Writer, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	pcap, err := pcapwriter.NewWriter(buf, time.Unix(1000, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcap.WriteStandardHeader()
+	return pcap, buf
+}
+
+func readPackets(t *testing.T, buf *bytes.Buffer) []gopacket.Packet {
+	t.Helper()
+	r, err := pcapgo.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []gopacket.Packet
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default))
+	}
+}
+
+func icmpOf(p gopacket.Packet) *layers.ICMPv4 {
+	if l, ok := p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		return l
+	}
+	return nil
+}
+
+func TestTraceroute(t *testing.T) {
+	hops := []net.IP{net.IPv4(192, 168, 1, 1), nil, net.IPv4(203, 0, 113, 9)}
+	for _, useICMP := range []bool{false, true} {
+		pcap, buf := capture(t)
+		tr := NewTraceroute(hops...)
+		tr.ICMP = useICMP
+		tr.Rand = rand.New(rand.NewSource(1))
+		if err := tr.Write(pcap, pcap, 0x0b, 0x01, 0x37); err != nil {
+			t.Fatal(err)
+		}
+
+		var probes, exceeded, final int
+		var sources []string
+		for _, p := range readPackets(t, buf) {
+			ip := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			m := icmpOf(p)
+			switch {
+			case ip.SrcIP.String() == "192.168.11.11":
+				probes += 1
+				if want := uint8(probes-1)/3 + 1; ip.TTL != want {
+					t.Errorf("icmp=%v: probe %d has TTL %d", useICMP, probes, ip.TTL)
+				}
+			case m.TypeCode.Type() == layers.ICMPv4TypeTimeExceeded:
+				exceeded += 1
+				sources = append(sources, ip.SrcIP.String())
+			default:
+				final += 1
+				if ip.SrcIP.String() != "192.168.55.55" {
+					t.Errorf("icmp=%v: final answer from %v", useICMP, ip.SrcIP)
+				}
+			}
+		}
+		if probes != 12 || exceeded != 6 || final != 3 {
+			t.Errorf("icmp=%v: %d probes, %d exceeded, %d final", useICMP, probes, exceeded, final)
+		}
+		if sources[0] != "192.168.1.1" || sources[3] != "203.0.113.9" {
+			t.Errorf("icmp=%v: wrong hops %v", useICMP, sources)
+		}
+	}
+}
+
+func TestSYNScan(t *testing.T) {
+	pcap, buf := capture(t)
+	s := &Scan{
+		Kind:    SYN,
+		Addrs:   []uint8{0x20, 0x21},
+		Targets: []Target{{Addr: 0x20, Open: []uint16{22, 80}, Filtered: []uint16{443}}},
+		Ports:   []uint16{22, 23, 80, 443},
+		Delay:   time.Millisecond,
+		RTT:     time.Millisecond,
+		Rand:    rand.New(rand.NewSource(1)),
+	}
+	if err := s.Write(pcap, pcap, 0x0b); err != nil {
+		t.Fatal(err)
+	}
+
+	synAck := map[layers.TCPPort]bool{}
+	rst := map[layers.TCPPort]bool{}
+	probes := 0
+	for _, p := range readPackets(t, buf) {
+		tcp := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		switch {
+		case tcp.SYN && tcp.ACK:
+			synAck[tcp.SrcPort] = true
+		case tcp.SYN:
+			probes += 1
+		case tcp.RST && tcp.ACK:
+			rst[tcp.SrcPort] = true
+		}
+	}
+	if !synAck[22] || !synAck[80] || len(synAck) != 2 {
+		t.Error("wrong open ports:", synAck)
+	}
+	if !rst[23] || len(rst) != 1 {
+		t.Error("wrong closed ports:", rst)
+	}
+	// Filtered and down get retried
+	if probes != 4+1+4*2 {
+		t.Error("wrong number of probes:", probes)
+	}
+}
+
+func TestUDPScan(t *testing.T) {
+	pcap, buf := capture(t)
+	s := &Scan{
+		Kind:    UDP,
+		Addrs:   []uint8{0x20},
+		Targets: []Target{{Addr: 0x20, Open: []uint16{53}}},
+		Ports:   []uint16{53, 161},
+	}
+	if err := s.Write(pcap, pcap, 0x0b); err != nil {
+		t.Fatal(err)
+	}
+	var unreachable int
+	for _, p := range readPackets(t, buf) {
+		if m := icmpOf(p); m != nil {
+			unreachable += 1
+			quoted := gopacket.NewPacket(m.Payload, layers.LayerTypeIPv4, gopacket.Default)
+			if udp := quoted.Layer(layers.LayerTypeUDP).(*layers.UDP); udp.DstPort != 161 {
+				t.Error("unreachable for wrong port:", udp.DstPort)
+			}
+		}
+	}
+	if unreachable != 1 {
+		t.Error("wrong number of unreachables:", unreachable)
+	}
+}
+
+func TestPingSweep(t *testing.T) {
+	pcap, buf := capture(t)
+	s := &Scan{Kind: Ping, Addrs: []uint8{1, 2, 3}, Targets: []Target{{Addr: 2}}}
+	if err := s.Write(pcap, pcap, 0x0b); err != nil {
+		t.Fatal(err)
+	}
+	packets := readPackets(t, buf)
+	if len(packets) != 4 {
+		t.Fatal("wrong number of frames:", len(packets))
+	}
+	if m := icmpOf(packets[2]); m.TypeCode.Type() != layers.ICMPv4TypeEchoReply {
+		t.Error("live host didn't answer")
+	}
+}
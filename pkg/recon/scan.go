@@ -0,0 +1,209 @@
+package recon
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/icmp"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Scan kinds
+const (
+	SYN  = "syn"
+	UDP  = "udp"
+	Ping = "ping"
+)
+
+// Target is a host on the scanned subnet
+type Target struct {
+	// Host number on the scanned subnet
+	Addr uint8
+
+	// Open ports; every other port is closed
+	Open []uint16
+
+	// Ports that never answer, as if firewalled
+	Filtered []uint16
+}
+
+// Scan describes an nmap-style scan.
+type Scan struct {
+	// SYN, UDP, or Ping
+	Kind string
+
+	// Addresses to scan; only those in Targets are up
+	Addrs []uint8
+
+	// Hosts that are up
+	Targets []Target
+
+	// Ports to scan, for SYN and UDP scans
+	Ports []uint16
+
+	// Time between probes, and round trip time to each target
+	Delay time.Duration
+	RTT   time.Duration
+
+	// Source of port order and the source port;
+	// if nil, the math/rand default source is used
+	Rand *rand.Rand
+}
+
+func (s *Scan) intn(n int) int {
+	return pcapwriter.Random(s.Rand).Intn(n)
+}
+
+func contains(ports []uint16, port uint16) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes the scan from the host at addrScanner.
+//
+// Like nmap, ports are probed in random order, from a single source port.
+// Probes that get no answer are tried a second time.
+// clock paces the probes.
+func (s *Scan) Write(w io.Writer, clock *pcapwriter.Writer, addrScanner uint8) error {
+	targets := make(map[uint8]Target)
+	for _, t := range s.Targets {
+		targets[t.Addr] = t
+	}
+	ports := append([]uint16{}, s.Ports...)
+	for i := len(ports) - 1; i > 0; i-- {
+		j := s.intn(i + 1)
+		ports[i], ports[j] = ports[j], ports[i]
+	}
+	srcPort := uint16(32768 + s.intn(28232))
+
+	for _, addr := range s.Addrs {
+		t, up := targets[addr]
+		var err error
+		switch s.Kind {
+		case Ping:
+			p := icmp.NewPing(w, addrScanner, addr, icmp.Linux)
+			p.Clock = clock
+			p.RTT = s.RTT
+			p.Interval = s.Delay
+			if up {
+				err = p.Echo(nil)
+			} else {
+				err = p.Unanswered()
+			}
+		case SYN:
+			for _, port := range ports {
+				if err = s.syn(w, clock, addrScanner, srcPort, t, up, addr, port); err != nil {
+					break
+				}
+			}
+		case UDP:
+			for _, port := range ports {
+				if err = s.udp(w, clock, addrScanner, srcPort, t, up, addr, port); err != nil {
+					break
+				}
+			}
+		default:
+			return fmt.Errorf("unknown scan kind: %s", s.Kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segment writes one TCP segment
+func segment(b *pcapwriter.IPv4Base, tcp *layers.TCP) error {
+	tcp.SetNetworkLayerForChecksum(&b.IPv4)
+	_, err := b.WritePacket(tcp)
+	return err
+}
+
+func (s *Scan) syn(w io.Writer, clock *pcapwriter.Writer, scanner uint8, srcPort uint16, t Target, up bool, addr uint8, port uint16) error {
+	var a, b pcapwriter.IPv4Base
+	a.Writer, b.Writer = w, w
+	a.PopulateBase(scanner, addr)
+	b.PopulateBase(addr, scanner)
+	a.Protocol, b.Protocol = layers.IPProtocolTCP, layers.IPProtocolTCP
+	// nmap's raw SYNs don't set DF
+	a.Flags = 0
+
+	seq := uint32(s.intn(1 << 31))
+	probe := func() error {
+		// MSS 1460, and nothing else, like nmap
+		opts := []layers.TCPOption{{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}}}
+		return segment(&a, &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(port), Seq: seq, SYN: true, Window: 1024, Options: opts})
+	}
+	if err := probe(); err != nil {
+		return err
+	}
+
+	if !up || contains(t.Filtered, port) {
+		// No answer, so try again
+		clock.Sleep(s.RTT * 10)
+		if err := probe(); err != nil {
+			return err
+		}
+		clock.Sleep(s.Delay)
+		return nil
+	}
+
+	clock.Sleep(s.RTT)
+	reply := &layers.TCP{SrcPort: layers.TCPPort(port), DstPort: layers.TCPPort(srcPort), Ack: seq + 1, ACK: true, Window: 29200}
+	if contains(t.Open, port) {
+		reply.SYN = true
+		reply.Seq = uint32(s.intn(1 << 31))
+		reply.Options = []layers.TCPOption{{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}}}
+	} else {
+		reply.RST = true
+		reply.Window = 0
+	}
+	if err := segment(&b, reply); err != nil {
+		return err
+	}
+
+	if reply.SYN {
+		// The scanner's kernel never sent the SYN, so it resets the connection
+		if err := segment(&a, &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(port), Seq: seq + 1, RST: true}); err != nil {
+			return err
+		}
+	}
+	clock.Sleep(s.Delay)
+	return nil
+}
+
+func (s *Scan) udp(w io.Writer, clock *pcapwriter.Writer, scanner uint8, srcPort uint16, t Target, up bool, addr uint8, port uint16) error {
+	rec := &icmp.Recorder{Writer: w}
+	cli, _ := pcapwriter.NewUDPv4Writers(rec, scanner, rec, addr)
+	cli.SrcPort = layers.UDPPort(srcPort)
+	cli.DstPort = layers.UDPPort(port)
+	cli.Flags = 0
+
+	if _, err := cli.WritePacket(&cli.UDP, gopacket.Payload(nil)); err != nil {
+		return err
+	}
+	if up && !contains(t.Open, port) && !contains(t.Filtered, port) {
+		clock.Sleep(s.RTT)
+		if err := icmp.NewErrorWriter(w, addr).Unreachable(rec.Last, layers.ICMPv4CodePort); err != nil {
+			return err
+		}
+		clock.Sleep(s.Delay)
+		return nil
+	}
+
+	// Open ports usually ignore an empty datagram, as do firewalls
+	clock.Sleep(s.RTT * 10)
+	if _, err := cli.WritePacket(&cli.UDP, gopacket.Payload(nil)); err != nil {
+		return err
+	}
+	clock.Sleep(s.Delay)
+	return nil
+}
@@ -0,0 +1,138 @@
+// Package recon generates reconnaissance traffic:
+// traceroutes, and port scans across a simulated subnet.
+package recon
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/icmp"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// BasePort is the first destination port of a UDP traceroute
+const BasePort = 33434
+
+// Traceroute describes a traceroute run.
+type Traceroute struct {
+	// Router addresses along the path, nearest first.
+	// A nil entry is a router that never answers.
+	Hops []net.IP
+
+	// Probe with ICMP echo requests, like Windows tracert,
+	// instead of UDP, like Linux traceroute.
+	ICMP bool
+
+	// Probes sent to each hop
+	Probes int
+
+	// Round trip time to the first hop, and added by each hop after it
+	FirstHop time.Duration
+	PerHop   time.Duration
+
+	// Source of latency jitter and the source port;
+	// if nil, the math/rand default source is used
+	Rand *rand.Rand
+}
+
+// NewTraceroute returns a Traceroute through hops,
+// with latencies typical of a home connection.
+func NewTraceroute(hops ...net.IP) *Traceroute {
+	return &Traceroute{
+		Hops:     hops,
+		Probes:   3,
+		FirstHop: time.Millisecond,
+		PerHop:   8 * time.Millisecond,
+	}
+}
+
+func (t *Traceroute) int63n(n int64) int64 {
+	return pcapwriter.Random(t.Rand).Int63n(n)
+}
+
+// rtt returns a round trip time to hop n, counting from 0
+func (t *Traceroute) rtt(n int) time.Duration {
+	d := t.FirstHop + time.Duration(n)*t.PerHop
+	// Up to 20% jitter
+	if j := int64(d) / 5; j > 0 {
+		d += time.Duration(t.int63n(j))
+	}
+	return d
+}
+
+// Write writes a traceroute from addrSrc to addrDst,
+// through the gateway addrGateway, the first of Hops;
+// all three are host numbers.
+// The destination answers after the last hop.
+// clock paces the probes.
+func (t *Traceroute) Write(w io.Writer, clock *pcapwriter.Writer, addrSrc, addrGateway, addrDst uint8) error {
+	rec := &icmp.Recorder{Writer: w}
+
+	// Probes go to the destination, through the gateway
+	udp, _ := pcapwriter.NewUDPv4Writers(rec, addrSrc, rec, addrDst)
+	udp.SrcPort = layers.UDPPort(32768 + t.int63n(28232))
+	ping := icmp.NewPing(rec, addrSrc, addrDst, icmp.Windows)
+	gw := net.HardwareAddr{0, 0, addrGateway, addrGateway, addrGateway, addrGateway}
+	udp.DstMAC = gw
+	ping.Request.DstMAC = gw
+	ping.Reply.SrcMAC = gw
+	ping.Interval = 0
+	ping.Clock = clock
+
+	dst := pcapwriter.IPv4Base{}
+	dst.PopulateBase(addrDst, addrSrc)
+	routers := icmp.NewErrorWriter(w, addrGateway)
+
+	// Linux traceroute's default payload
+	payload := []byte("@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_")
+
+	seq := 0
+	for hop := 0; hop <= len(t.Hops); hop++ {
+		last := hop == len(t.Hops)
+		for probe := 0; probe < t.Probes; probe++ {
+			rtt := t.rtt(hop)
+			var err error
+			if t.ICMP {
+				ping.Request.TTL = uint8(hop + 1)
+				if last {
+					ping.RTT = rtt
+					err = ping.Echo(nil)
+				} else {
+					err = ping.Unanswered()
+				}
+			} else {
+				udp.TTL = uint8(hop + 1)
+				udp.DstPort = layers.UDPPort(BasePort + seq)
+				_, err = udp.WritePacket(&udp.UDP, gopacket.Payload(payload))
+			}
+			if err != nil {
+				return err
+			}
+			seq += 1
+
+			switch {
+			case last && t.ICMP:
+				// The echo reply is already written
+			case last:
+				clock.Sleep(rtt)
+				routers.SrcIP, routers.TTL = dst.SrcIP, 64
+				err = routers.Unreachable(rec.Last, layers.ICMPv4CodePort)
+			case t.Hops[hop] == nil:
+				// Waits for the timeout
+				clock.Sleep(5 * time.Second)
+			default:
+				clock.Sleep(rtt)
+				routers.SrcIP, routers.TTL = t.Hops[hop], 255
+				err = routers.TimeExceeded(rec.Last)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
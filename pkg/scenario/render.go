@@ -0,0 +1,249 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/noise"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/payload"
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+type frame struct {
+	when time.Time
+	data []byte
+}
+
+// track is one flow, rendered on its own clock
+type track struct {
+	buf  bytes.Buffer
+	pcap *pcapwriter.Writer
+}
+
+func newTrack(start time.Time, jitter time.Duration, seed int64) (*track, error) {
+	t := new(track)
+	pcap, err := pcapwriter.NewWriter(&t.buf, start, jitter)
+	if err != nil {
+		return nil, err
+	}
+	pcap.Rand = rand.New(rand.NewSource(seed))
+	pcap.WriteStandardHeader()
+	t.pcap = pcap
+	return t, nil
+}
+
+func (t *track) frames() ([]frame, error) {
+	r, err := pcapgo.NewReader(&t.buf)
+	if err != nil {
+		return nil, err
+	}
+	var frames []frame
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame{ci.Timestamp, data})
+	}
+}
+
+// address points b from src to dst
+func address(b *pcapwriter.IPv4Base, src, dst Host) {
+	if src.IP != "" {
+		b.SrcIP = net.ParseIP(src.IP)
+	}
+	if dst.IP != "" {
+		b.DstIP = net.ParseIP(dst.IP)
+	}
+	if src.MAC != "" {
+		b.SrcMAC, _ = net.ParseMAC(src.MAC)
+	}
+	if dst.MAC != "" {
+		b.DstMAC, _ = net.ParseMAC(dst.MAC)
+	}
+}
+
+// data returns the bytes of p
+func (s *Scenario) data(p *Payload, templates *payload.Templates) ([]byte, error) {
+	switch {
+	case p.Template != "":
+		return templates.Render(p.Template)
+	case p.Hex != "":
+		return hex.DecodeString(strings.Join(strings.Fields(p.Hex), ""))
+	case p.File != "":
+		name := p.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(s.Dir, name)
+		}
+		return os.ReadFile(name)
+	}
+	return []byte(p.Text), nil
+}
+
+// send writes p, as many times as it says
+func (s *Scenario) send(w io.Writer, p *Payload, templates *payload.Templates) error {
+	n := p.Repeat
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		data, err := s.data(p, templates)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderFlow renders f onto t.
+// Counters in templates carry on across the whole flow.
+func (s *Scenario) renderFlow(f Flow, t *track, templates *payload.Templates) error {
+	janky := pcapwriter.NewJankyWriter(pcapwriter.NopCloser{Writer: t.pcap})
+	cli, srv := s.Hosts[f.Client], s.Hosts[f.Server]
+
+	var conv *pcapwriter.Conversation
+	var tcpCli, tcpSrv *pcapwriter.TCPv4Writer
+	switch f.Proto {
+	case UDP:
+		a, b := pcapwriter.NewUDPv4Writers(janky, cli.Addr, janky, srv.Addr)
+		address(&a.IPv4Base, cli, srv)
+		address(&b.IPv4Base, srv, cli)
+		a.Encapsulation, b.Encapsulation = f.Encapsulation, f.Encapsulation
+		if f.ClientPort != 0 {
+			a.SrcPort, b.DstPort = layers.UDPPort(f.ClientPort), layers.UDPPort(f.ClientPort)
+		}
+		if f.ServerPort != 0 {
+			a.DstPort, b.SrcPort = layers.UDPPort(f.ServerPort), layers.UDPPort(f.ServerPort)
+		}
+		conv = pcapwriter.NewConversation(a, b)
+	case TCP:
+		a, b := pcapwriter.NewTCPv4Writers(janky, cli.Addr, janky, srv.Addr)
+		address(&a.IPv4Base, cli, srv)
+		address(&b.IPv4Base, srv, cli)
+		a.Encapsulation, b.Encapsulation = f.Encapsulation, f.Encapsulation
+		if f.ClientPort != 0 {
+			a.SrcPort, b.DstPort = layers.TCPPort(f.ClientPort), layers.TCPPort(f.ClientPort)
+		}
+		if f.ServerPort != 0 {
+			a.DstPort, b.SrcPort = layers.TCPPort(f.ServerPort), layers.TCPPort(f.ServerPort)
+		}
+		tcpCli, tcpSrv = a, b
+		conv = pcapwriter.NewConversation(a, b)
+	case ICMP:
+		a, b := pcapwriter.NewICMPv4Writers(janky, cli.Addr, janky, srv.Addr)
+		address(&a.IPv4Base, cli, srv)
+		address(&b.IPv4Base, srv, cli)
+		a.Encapsulation, b.Encapsulation = f.Encapsulation, f.Encapsulation
+		conv = pcapwriter.NewConversation(a, b)
+	}
+
+	for _, step := range f.Steps {
+		var err error
+		switch {
+		case step.Client != nil:
+			err = s.send(conv.Client(), step.Client, templates)
+		case step.Server != nil:
+			err = s.send(conv.Server(), step.Server, templates)
+		case step.Sleep > 0:
+			t.pcap.Sleep(step.Sleep)
+		case step.Drop > 0:
+			janky.Drop(step.Drop)
+		case step.Defer > 0:
+			janky.Defer(step.Defer)
+		case step.Close == "client":
+			err = tcpCli.Close()
+		case step.Close == "server":
+			err = tcpSrv.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return janky.Close()
+}
+
+// Render writes the whole capture to w.
+//
+// Each flow, and the noise, is rendered on its own clock,
+// then everything is merged in time order.
+func (s *Scenario) Render(w io.Writer) error {
+	var all []frame
+	for i, f := range s.Flows {
+		jitter := f.Jitter
+		if jitter == 0 {
+			jitter = s.Jitter
+		}
+		t, err := newTrack(s.Start.Add(f.At), jitter, s.Seed+int64(i))
+		if err != nil {
+			return err
+		}
+		templates := payload.New(rand.New(rand.NewSource(pcapwriter.SubSeed(s.Seed+int64(i), "payload"))))
+		if err := s.renderFlow(f, t, templates); err != nil {
+			return err
+		}
+		frames, err := t.frames()
+		if err != nil {
+			return err
+		}
+		all = append(all, frames...)
+	}
+
+	if s.Noise != nil {
+		// With no jitter, noise has the track's random source to itself
+		t, err := newTrack(s.Start, 0, pcapwriter.SubSeed(s.Seed, "noise"))
+		if err != nil {
+			return err
+		}
+		mix, err := noise.ParseMix(s.Noise.Mix)
+		if err != nil {
+			return err
+		}
+		bg := noise.New(t.pcap, t.pcap, mix)
+		if s.Noise.Rate > 0 {
+			bg.Rate = s.Noise.Rate
+		}
+		bg.Rand = t.pcap.Rand
+		bg.End = s.Start.Add(s.Noise.Duration)
+		if err := bg.Finish(); err != nil {
+			return err
+		}
+		frames, err := t.frames()
+		if err != nil {
+			return err
+		}
+		all = append(all, frames...)
+	}
+
+	// Stable, so frames at the same time keep flow order
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].when.Before(all[j].when)
+	})
+
+	pcap, err := pcapwriter.NewWriter(w, s.Start, 0)
+	if err != nil {
+		return err
+	}
+	pcap.WriteStandardHeader()
+	for _, f := range all {
+		pcap.Now = f.when
+		if _, err := pcap.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
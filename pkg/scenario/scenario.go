@@ -0,0 +1,220 @@
+// Package scenario renders a whole capture from a scenario file:
+// hosts, the flows between them, and background noise.
+//
+// Scenario files are YAML, or JSON, which is YAML too.
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"gopkg.in/yaml.v3"
+)
+
+// Flow protocols
+const (
+	UDP  = "udp"
+	TCP  = "tcp"
+	ICMP = "icmp"
+)
+
+// Host is an endpoint.
+// Its host number picks its addresses, unless IP or MAC say otherwise.
+type Host struct {
+	Addr uint8  `yaml:"addr"`
+	IP   string `yaml:"ip,omitempty"`
+	MAC  string `yaml:"mac,omitempty"`
+}
+
+// Payload is data one side sends, given as exactly one of
+// hex, text, the name of a file, relative to the scenario file,
+// or a template, as described in the payload package.
+type Payload struct {
+	Hex      string `yaml:"hex,omitempty"`
+	Text     string `yaml:"text,omitempty"`
+	File     string `yaml:"file,omitempty"`
+	Template string `yaml:"template,omitempty"`
+
+	// Send this many times; 0 means once
+	Repeat int `yaml:"repeat,omitempty"`
+}
+
+// Step is one thing that happens in a flow.
+// Exactly one of its fields must be set.
+type Step struct {
+	// Data sent by either side
+	Client *Payload `yaml:"client,omitempty"`
+	Server *Payload `yaml:"server,omitempty"`
+
+	// Time to wait before the next step
+	Sleep time.Duration `yaml:"sleep,omitempty"`
+
+	// Drop the next n frames, or hold the next frame back for n frames
+	Drop  int `yaml:"drop,omitempty"`
+	Defer int `yaml:"defer,omitempty"`
+
+	// For TCP: "client" or "server" closes its end
+	Close string `yaml:"close,omitempty"`
+}
+
+// Flow is a conversation between two hosts.
+type Flow struct {
+	Name   string `yaml:"name,omitempty"`
+	Proto  string `yaml:"proto"`
+	Client string `yaml:"client"`
+	Server string `yaml:"server"`
+
+	// Ports, for UDP and TCP; 0 picks the convention of pcapwriter
+	ClientPort uint16 `yaml:"client-port,omitempty"`
+	ServerPort uint16 `yaml:"server-port,omitempty"`
+
+	// When the flow starts, after the scenario start
+	At time.Duration `yaml:"at,omitempty"`
+
+	// Upper limit on random time between frames; 0 uses the scenario's
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+
+	// Extra layers between Ethernet and IPv4
+	Encapsulation pcapwriter.Encapsulation `yaml:"encapsulation,omitempty"`
+
+	Steps []Step `yaml:"steps"`
+}
+
+// Noise describes background traffic, as in the noise package.
+type Noise struct {
+	// Like "dns=40,https=30,ntp=10,ping=20"
+	Mix string `yaml:"mix"`
+
+	// Mean time between background exchanges
+	Rate time.Duration `yaml:"rate,omitempty"`
+
+	// How long background traffic keeps going
+	Duration time.Duration `yaml:"duration"`
+}
+
+// Scenario is a whole capture.
+type Scenario struct {
+	Start  time.Time       `yaml:"start"`
+	Seed   int64           `yaml:"seed"`
+	Jitter time.Duration   `yaml:"jitter,omitempty"`
+	Hosts  map[string]Host `yaml:"hosts"`
+	Flows  []Flow          `yaml:"flows"`
+	Noise  *Noise          `yaml:"noise,omitempty"`
+
+	// Where file payloads are found
+	Dir string `yaml:"-"`
+}
+
+// Load reads a scenario from a file.
+func Load(filename string) (*Scenario, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	s.Dir = filepath.Dir(filename)
+	return s, nil
+}
+
+// Parse parses a scenario, and checks that it makes sense.
+func Parse(data []byte) (*Scenario, error) {
+	s := &Scenario{
+		Start:  time.Date(2010, 2, 22, 22, 57, 23, 71877000, time.UTC),
+		Jitter: 20 * time.Millisecond,
+	}
+	// Unknown keys are most likely typos, which would quietly change the capture
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Check returns an error if s doesn't make sense
+func (s *Scenario) Check() error {
+	for name, h := range s.Hosts {
+		if h.IP != "" && net.ParseIP(h.IP).To4() == nil {
+			return fmt.Errorf("host %s: bad IPv4 address %q", name, h.IP)
+		}
+		if h.MAC != "" {
+			if _, err := net.ParseMAC(h.MAC); err != nil {
+				return fmt.Errorf("host %s: %w", name, err)
+			}
+		}
+	}
+
+	for i, f := range s.Flows {
+		name := f.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		switch f.Proto {
+		case UDP, TCP, ICMP:
+		default:
+			return fmt.Errorf("flow %s: unknown protocol %q", name, f.Proto)
+		}
+		for _, h := range []string{f.Client, f.Server} {
+			if _, ok := s.Hosts[h]; !ok {
+				return fmt.Errorf("flow %s: unknown host %q", name, h)
+			}
+		}
+		for j, step := range f.Steps {
+			n := 0
+			for _, set := range []bool{
+				step.Client != nil,
+				step.Server != nil,
+				step.Sleep != 0,
+				step.Drop != 0,
+				step.Defer != 0,
+				step.Close != "",
+			} {
+				if set {
+					n += 1
+				}
+			}
+			if n != 1 {
+				return fmt.Errorf("flow %s step %d: needs exactly one of client, server, sleep, drop, defer, or close", name, j+1)
+			}
+			for _, p := range []*Payload{step.Client, step.Server} {
+				if p == nil {
+					continue
+				}
+				n := 0
+				for _, v := range []string{p.Hex, p.Text, p.File, p.Template} {
+					if v != "" {
+						n += 1
+					}
+				}
+				if n != 1 {
+					return fmt.Errorf("flow %s step %d: payload needs exactly one of hex, text, file, or template", name, j+1)
+				}
+				if p.Repeat < 0 {
+					return fmt.Errorf("flow %s step %d: repeat %d is negative", name, j+1, p.Repeat)
+				}
+			}
+			switch step.Close {
+			case "":
+			case "client", "server":
+				if f.Proto != TCP {
+					return fmt.Errorf("flow %s step %d: only TCP flows close", name, j+1)
+				}
+			default:
+				return fmt.Errorf("flow %s step %d: close must be client or server, not %q", name, j+1, step.Close)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package scenario
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const twoFlows = `
+seed: 1
+start: 2020-01-01T00:00:00Z
+hosts:
+  a: {addr: 11}
+  b: {addr: 55, ip: 10.9.8.7, mac: "02:00:00:00:00:01"}
+flows:
+  - proto: udp
+    client: a
+    server: b
+    server-port: 9000
+    jitter: 1ms
+    steps:
+      - client: {text: first}
+      - sleep: 2s
+      - drop: 1
+      - client: {text: dropped}
+      - server: {hex: "6c 61 73 74"}
+  - proto: tcp
+    client: a
+    server: b
+    at: 1s
+    jitter: 1ms
+    steps:
+      - client: {text: middle}
+`
+
+func render(t *testing.T, text string) []gopacket.Packet {
+	t.Helper()
+	s, err := Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := s.Render(buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := pcapgo.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []gopacket.Packet
+	var last time.Time
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			return packets
+		}
+		if ci.Timestamp.Before(last) {
+			t.Error("frames out of order at", len(packets))
+		}
+		last = ci.Timestamp
+		packets = append(packets, gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default))
+	}
+}
+
+func TestRender(t *testing.T) {
+	packets := render(t, twoFlows)
+	var payloads []string
+	for _, p := range packets {
+		if app := p.ApplicationLayer(); app != nil {
+			payloads = append(payloads, string(app.Payload()))
+		}
+	}
+	if got := strings.Join(payloads, " "); got != "first middle last" {
+		t.Error("wrong payloads:", got)
+	}
+
+	ip := packets[0].Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	eth := packets[0].Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	udp := packets[0].Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if ip.DstIP.String() != "10.9.8.7" || eth.DstMAC.String() != "02:00:00:00:00:01" || udp.DstPort != 9000 {
+		t.Errorf("wrong addressing: %v %v %v", ip.DstIP, eth.DstMAC, udp.DstPort)
+	}
+	if ip.SrcIP.String() != "192.168.11.11" {
+		t.Error("wrong conventional address:", ip.SrcIP)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	packets := render(t, `
+hosts: {a: {addr: 1}, b: {addr: 2}}
+flows:
+  - proto: udp
+    client: a
+    server: b
+    steps:
+      - client: {template: '{{counter "n" | u8}}', repeat: 3}
+      - server: {template: '{{counter "n" | u8}}'}
+`)
+	for i, p := range packets {
+		if got := p.ApplicationLayer().Payload(); !bytes.Equal(got, []byte{byte(i)}) {
+			t.Errorf("frame %d: %x", i, got)
+		}
+	}
+	if len(packets) != 4 {
+		t.Error("wrong number of frames:", len(packets))
+	}
+}
+
+func TestNoise(t *testing.T) {
+	packets := render(t, twoFlows+`
+noise: {mix: "dns=1", rate: 100ms, duration: 3s}
+`)
+	dns := 0
+	for _, p := range packets {
+		if p.Layer(layers.LayerTypeDNS) != nil {
+			dns += 1
+		}
+	}
+	if dns < 10 {
+		t.Error("not enough noise:", dns)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []string{
+		"flows: [{proto: sctp}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: z}]",
+		"hosts: {a: {addr: 1, ip: 'nope'}}",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{client: {hex: '00', text: 'x'}}]}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{close: client}]}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{client: {text: x}, sleep: 1s}]}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{}]}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{sleeep: 2s}]}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, serverport: 53}]",
+		"hosts: {a: {addr: 1}}\nflows: [{proto: udp, client: a, server: a, steps: [{client: {text: x, repeat: -1}}]}]",
+	}
+	for _, c := range cases {
+		if _, err := Parse([]byte(c)); err == nil {
+			t.Errorf("%q parsed", c)
+		}
+	}
+}
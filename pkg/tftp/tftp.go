@@ -0,0 +1,229 @@
+// Package tftp generates TFTP transfers over UDP,
+// including option negotiation and errors.
+package tftp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket/layers"
+)
+
+// Port is the TFTP server port
+const Port = 69
+
+// DefaultBlockSize is the block size without the blksize option
+const DefaultBlockSize = 512
+
+// Block sizes the blksize option allows (RFC 2348)
+const (
+	MinBlockSize = 8
+	MaxBlockSize = 65464
+)
+
+// Opcodes
+const (
+	OpRRQ   = 1
+	OpWRQ   = 2
+	OpDATA  = 3
+	OpACK   = 4
+	OpERROR = 5
+	OpOACK  = 6
+)
+
+// Error codes
+const (
+	ErrUndefined  = 0
+	ErrNotFound   = 1
+	ErrAccess     = 2
+	ErrDiskFull   = 3
+	ErrIllegalOp  = 4
+	ErrUnknownTID = 5
+	ErrExists     = 6
+	ErrNoSuchUser = 7
+	ErrOptions    = 8
+)
+
+// Error is a TFTP ERROR packet
+type Error struct {
+	Code    uint16
+	Message string
+}
+
+// Transfer describes one TFTP transfer.
+type Transfer struct {
+	// Write the file to the server (WRQ), instead of reading it (RRQ)
+	Put bool
+
+	Name string
+
+	// "octet" or "netascii"; if empty, "octet"
+	Mode string
+
+	Data []byte
+
+	// If nonzero, the client asks for this block size with the blksize option,
+	// and the server agrees.
+	// It must be between MinBlockSize and MaxBlockSize.
+	BlockSize int
+
+	// If set, the server sends this error after FailAfter blocks,
+	// aborting the transfer.
+	// With FailAfter zero, the server refuses the request outright.
+	Fail      *Error
+	FailAfter int
+}
+
+// FileTransfer returns a Transfer of the file called name,
+// which is sent under its base name.
+func FileTransfer(put bool, name string) (Transfer, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Transfer{}, err
+	}
+	return Transfer{Put: put, Name: filepath.Base(name), Data: data}, nil
+}
+
+// Generator writes TFTP transfers between a client and a server.
+type Generator struct {
+	Client *pcapwriter.UDPv4Writer
+	Server *pcapwriter.UDPv4Writer
+
+	// Source of port numbers;
+	// if nil, the math/rand default source is used
+	Rand *rand.Rand
+}
+
+// NewGenerator creates a Generator for a client and a TFTP server,
+// at host numbers addrClient and addrServer.
+func NewGenerator(w io.Writer, addrClient uint8, addrServer uint8) *Generator {
+	cli, srv := pcapwriter.NewUDPv4Writers(w, addrClient, w, addrServer)
+	return &Generator{
+		Client: cli,
+		Server: srv,
+	}
+}
+
+func (g *Generator) port() layers.UDPPort {
+	n := 0x10000 - 1024
+	return layers.UDPPort(1024 + pcapwriter.Random(g.Rand).Intn(n))
+}
+
+func cstrings(op uint16, s ...string) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, op)
+	for _, v := range s {
+		buf = append(buf, v...)
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func block(op uint16, n uint16, data []byte) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, op)
+	buf = binary.BigEndian.AppendUint16(buf, n)
+	return append(buf, data...)
+}
+
+func errorPacket(e *Error) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, OpERROR)
+	buf = binary.BigEndian.AppendUint16(buf, e.Code)
+	buf = append(buf, e.Message...)
+	return append(buf, 0)
+}
+
+// Write writes a transfer.
+//
+// Like a real server, replies come from a new port, chosen at random,
+// as does the client port.
+func (g *Generator) Write(x Transfer) error {
+	if x.BlockSize != 0 && (x.BlockSize < MinBlockSize || x.BlockSize > MaxBlockSize) {
+		return fmt.Errorf("block size %d is outside %d-%d", x.BlockSize, MinBlockSize, MaxBlockSize)
+	}
+	clientPort := g.port()
+	g.Client.SrcPort, g.Client.DstPort = clientPort, Port
+	g.Server.SrcPort, g.Server.DstPort = Port, clientPort
+
+	mode := x.Mode
+	if mode == "" {
+		mode = "octet"
+	}
+	op := uint16(OpRRQ)
+	if x.Put {
+		op = OpWRQ
+	}
+	fields := []string{x.Name, mode}
+	if x.BlockSize > 0 {
+		tsize := 0
+		if x.Put {
+			tsize = len(x.Data)
+		}
+		fields = append(fields, "blksize", strconv.Itoa(x.BlockSize), "tsize", strconv.Itoa(tsize))
+	}
+	if _, err := g.Client.Write(cstrings(op, fields...)); err != nil {
+		return err
+	}
+
+	// The rest of the transfer is with the server's new port
+	serverPort := g.port()
+	g.Server.SrcPort = serverPort
+	g.Client.DstPort = serverPort
+
+	if x.Fail != nil && x.FailAfter == 0 {
+		_, err := g.Server.Write(errorPacket(x.Fail))
+		return err
+	}
+
+	// sender sends DATA, receiver sends ACK
+	sender, receiver := g.Server, g.Client
+	if x.Put {
+		sender, receiver = g.Client, g.Server
+	}
+
+	size := DefaultBlockSize
+	if x.BlockSize > 0 {
+		size = x.BlockSize
+		oack := cstrings(OpOACK, "blksize", strconv.Itoa(size), "tsize", strconv.Itoa(len(x.Data)))
+		if _, err := g.Server.Write(oack); err != nil {
+			return err
+		}
+		if !x.Put {
+			// The client acknowledges the OACK
+			if _, err := g.Client.Write(block(OpACK, 0, nil)); err != nil {
+				return err
+			}
+		}
+	} else if x.Put {
+		if _, err := g.Server.Write(block(OpACK, 0, nil)); err != nil {
+			return err
+		}
+	}
+
+	data := x.Data
+	for n := 1; ; n++ {
+		if x.Fail != nil && n > x.FailAfter {
+			_, err := g.Server.Write(errorPacket(x.Fail))
+			return err
+		}
+		chunk := data
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		data = data[len(chunk):]
+		if _, err := sender.Write(block(OpDATA, uint16(n), chunk)); err != nil {
+			return err
+		}
+		if _, err := receiver.Write(block(OpACK, uint16(n), nil)); err != nil {
+			return err
+		}
+		// A short block ends the transfer
+		if len(chunk) < size {
+			return nil
+		}
+	}
+}
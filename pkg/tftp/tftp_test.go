@@ -0,0 +1,114 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// datagrams records the UDP payloads written
+type datagrams []*layers.UDP
+
+func (d *datagrams) Write(frame []byte) (int, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	*d = append(*d, packet.Layer(layers.LayerTypeUDP).(*layers.UDP))
+	return len(frame), nil
+}
+
+func opcode(u *layers.UDP) uint16 {
+	return binary.BigEndian.Uint16(u.Payload)
+}
+
+// reassemble collects the DATA blocks in order
+func reassemble(t *testing.T, d datagrams) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	next := uint16(1)
+	for _, u := range d {
+		if opcode(u) != OpDATA {
+			continue
+		}
+		if n := binary.BigEndian.Uint16(u.Payload[2:]); n != next {
+			t.Fatalf("block %d out of order, wanted %d", n, next)
+		}
+		next += 1
+		buf.Write(u.Payload[4:])
+	}
+	return buf.Bytes()
+}
+
+func TestTransfers(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 128) // exactly 4 default blocks
+
+	cases := []struct {
+		name   string
+		x      Transfer
+		frames int
+	}{
+		{"get", Transfer{Name: "boot.img", Data: data}, 2 + 5*2 - 1},
+		{"put", Transfer{Put: true, Name: "config", Data: data[:1000]}, 2 + 2*2},
+		{"blksize", Transfer{Name: "boot.img", Data: data, BlockSize: 1428}, 3 + 2*2},
+	}
+	for _, c := range cases {
+		d := new(datagrams)
+		g := NewGenerator(d, 0x0b, 0x45)
+		g.Rand = rand.New(rand.NewSource(1))
+		if err := g.Write(c.x); err != nil {
+			t.Fatal(err)
+		}
+
+		got := *d
+		if len(got) != c.frames {
+			t.Errorf("%s: wrong number of packets: %d", c.name, len(got))
+		}
+		if got[0].DstPort != Port {
+			t.Errorf("%s: request didn't go to port 69", c.name)
+		}
+		if got[1].SrcPort == Port || got[1].DstPort != got[0].SrcPort {
+			t.Errorf("%s: server didn't reply from a new port", c.name)
+		}
+		for _, u := range got[2:] {
+			if u.SrcPort == Port || u.DstPort == Port {
+				t.Errorf("%s: port 69 used after the request", c.name)
+			}
+		}
+		if !bytes.Equal(reassemble(t, got), c.x.Data) {
+			t.Errorf("%s: wrong data", c.name)
+		}
+		if c.x.BlockSize > 0 && (opcode(got[1]) != OpOACK || !bytes.Contains(got[1].Payload, []byte("blksize\x001428\x00"))) {
+			t.Errorf("%s: no OACK", c.name)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	d := new(datagrams)
+	g := NewGenerator(d, 0x0b, 0x45)
+	g.Write(Transfer{Name: "flag.txt", Fail: &Error{ErrNotFound, "File not found"}})
+	if len(*d) != 2 || opcode((*d)[1]) != OpERROR {
+		t.Error("request not refused")
+	}
+
+	d = new(datagrams)
+	g = NewGenerator(d, 0x0b, 0x45)
+	g.Write(Transfer{Name: "big", Data: make([]byte, 5000), Fail: &Error{ErrDiskFull, "Disk full"}, FailAfter: 2})
+	last := (*d)[len(*d)-1]
+	if opcode(last) != OpERROR || binary.BigEndian.Uint16(last.Payload[2:]) != ErrDiskFull {
+		t.Error("transfer didn't end in an error")
+	}
+	if n := len(reassemble(t, *d)); n != 2*DefaultBlockSize {
+		t.Error("wrong amount sent before the error:", n)
+	}
+
+	for _, size := range []int{-1, MinBlockSize - 1, MaxBlockSize + 1} {
+		d = new(datagrams)
+		g = NewGenerator(d, 0x0b, 0x45)
+		if err := g.Write(Transfer{Name: "x", BlockSize: size}); err == nil || len(*d) != 0 {
+			t.Errorf("block size %d accepted", size)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package tls generates real TLS sessions,
+// with keys that can be written to an SSLKEYLOGFILE
+// so Wireshark can decrypt them.
+package tls
+
+import (
+	gotls "crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+)
+
+// Exchange is one request from the client, and the server's response
+type Exchange struct {
+	Request  []byte
+	Response []byte
+}
+
+// Session describes a TLS session.
+type Session struct {
+	// Server name sent in SNI, and put in the generated certificate
+	ServerName string
+
+	// Protocols offered by the client in ALPN; the server picks the first
+	ALPN []string
+
+	// VersionTLS12 or VersionTLS13; zero lets the endpoints negotiate
+	Version uint16
+
+	// Cipher suites offered by the client; only used by TLS 1.2
+	CipherSuites []uint16
+
+	// Certificate authority to issue the server certificate;
+	// if nil, one is generated
+	Authority *Authority
+
+	// Application data
+	Exchanges []Exchange
+
+	// If set, session secrets are written here in SSLKEYLOGFILE format
+	KeyLog io.Writer
+}
+
+// TLS versions, re-exported for convenience
+const (
+	VersionTLS12 = gotls.VersionTLS12
+	VersionTLS13 = gotls.VersionTLS13
+)
+
+// conn makes a Tap look enough like a net.Conn for crypto/tls
+type conn struct {
+	*pcapwriter.Tap
+}
+
+type tapAddr struct{}
+
+func (tapAddr) Network() string { return "tap" }
+func (tapAddr) String() string  { return "tap" }
+
+func (c conn) LocalAddr() net.Addr                { return tapAddr{} }
+func (c conn) RemoteAddr() net.Addr               { return tapAddr{} }
+func (c conn) SetDeadline(t time.Time) error      { return nil }
+func (c conn) SetReadDeadline(t time.Time) error  { return nil }
+func (c conn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Close only closes the write side,
+// so the peer's close_notify is still recorded.
+func (c conn) Close() error {
+	return c.CloseWrite()
+}
+
+func (s *Session) configs() (*gotls.Config, *gotls.Config, error) {
+	ca := s.Authority
+	if ca == nil {
+		var err error
+		if ca, err = NewAuthority("pcapgen CA"); err != nil {
+			return nil, nil, err
+		}
+	}
+	var names []string
+	if s.ServerName != "" {
+		names = append(names, s.ServerName)
+	}
+	cert, err := ca.Issue(names...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verify against the generated CA, as of a moment it's valid
+	now := func() time.Time { return notBefore.Add(24 * time.Hour) }
+
+	client := &gotls.Config{
+		ServerName:   s.ServerName,
+		NextProtos:   s.ALPN,
+		CipherSuites: s.CipherSuites,
+		MinVersion:   s.Version,
+		MaxVersion:   s.Version,
+		RootCAs:      ca.Pool(),
+		KeyLogWriter: s.KeyLog,
+		Time:         now,
+	}
+	server := &gotls.Config{
+		Certificates: []gotls.Certificate{cert},
+		NextProtos:   s.ALPN,
+		MinVersion:   s.Version,
+		MaxVersion:   s.Version,
+		Time:         now,
+	}
+	if s.ServerName == "" {
+		client.InsecureSkipVerify = true
+	}
+	return client, server, nil
+}
+
+// serve runs the server side of the session
+func (s *Session) serve(c *gotls.Conn) error {
+	defer c.Close()
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	for _, e := range s.Exchanges {
+		if _, err := io.ReadFull(c, make([]byte, len(e.Request))); err != nil {
+			return err
+		}
+		if _, err := c.Write(e.Response); err != nil {
+			return err
+		}
+	}
+
+	// Wait for the client's close_notify
+	io.Copy(io.Discard, c)
+	return nil
+}
+
+// Run performs the session between client and server,
+// which record what each side sends.
+//
+// These are typically the two halves of pcapwriter.NewTCPv4Writers.
+// Run doesn't close the TCP connection.
+func (s *Session) Run(client io.Writer, server io.Writer) error {
+	clientConf, serverConf, err := s.configs()
+	if err != nil {
+		return err
+	}
+
+	a, b := pcapwriter.NewBufferedTaps(client, server)
+	srv := gotls.Server(conn{b}, serverConf)
+	cli := gotls.Client(conn{a}, clientConf)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(srv)
+	}()
+
+	err = func() error {
+		defer cli.Close()
+		if err := cli.Handshake(); err != nil {
+			return err
+		}
+		for _, e := range s.Exchanges {
+			if _, err := cli.Write(e.Request); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(cli, make([]byte, len(e.Response))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+
+	if serr := <-done; serr != nil && err == nil {
+		err = fmt.Errorf("server: %w", serr)
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package tls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"git.cyberfire.ninja/devs/pcapgen/pkg/pcapwriter"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// streams reassembles the TCP payload sent by each side
+type streams struct {
+	client bytes.Buffer
+	server bytes.Buffer
+}
+
+func (s *streams) Write(frame []byte) (int, error) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp.SrcPort == 443 {
+		s.server.Write(tcp.Payload)
+	} else {
+		s.client.Write(tcp.Payload)
+	}
+	return len(frame), nil
+}
+
+// records splits a TLS byte stream into its records
+func records(t *testing.T, stream []byte) [][]byte {
+	t.Helper()
+	var recs [][]byte
+	for len(stream) > 0 {
+		if len(stream) < 5 {
+			t.Fatal("truncated record header")
+		}
+		n := 5 + int(stream[3])<<8 + int(stream[4])
+		if len(stream) < n {
+			t.Fatal("truncated record")
+		}
+		recs = append(recs, stream[:n])
+		stream = stream[n:]
+	}
+	return recs
+}
+
+func TestSession(t *testing.T) {
+	request := []byte("GET /flag HTTP/1.1\r\nHost: secret.example.com\r\n\r\n")
+	response := []byte("HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nmoo\n")
+
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		s := new(streams)
+		keylog := new(strings.Builder)
+		cli, srv := pcapwriter.NewTCPv4Writers(s, 0x01, s, 0x40)
+		srv.SrcPort = 443
+		cli.DstPort = 443
+
+		session := Session{
+			ServerName: "secret.example.com",
+			ALPN:       []string{"http/1.1"},
+			Version:    version,
+			Exchanges:  []Exchange{{request, response}, {request, response}},
+			KeyLog:     keylog,
+		}
+		if err := session.Run(cli, srv); err != nil {
+			t.Fatal(version, err)
+		}
+		cli.Close()
+		srv.Close()
+
+		clientRecs := records(t, s.client.Bytes())
+		serverRecs := records(t, s.server.Bytes())
+		hello := clientRecs[0]
+		if hello[0] != 22 || hello[5] != 1 {
+			t.Fatalf("%x: first record isn't a ClientHello", version)
+		}
+		if !bytes.Contains(hello, []byte("secret.example.com")) || !bytes.Contains(hello, []byte("http/1.1")) {
+			t.Errorf("%x: ClientHello is missing SNI or ALPN", version)
+		}
+		if bytes.Contains(s.client.Bytes(), request) || bytes.Contains(s.server.Bytes(), response) {
+			t.Errorf("%x: plaintext visible on the wire", version)
+		}
+
+		appData := 0
+		for _, r := range append(clientRecs, serverRecs...) {
+			if r[0] == 23 {
+				appData += 1
+			}
+		}
+		if appData < 4 {
+			t.Errorf("%x: only %d application data records", version, appData)
+		}
+
+		// ClientHello random follows record header, handshake header, and version
+		random := hex.EncodeToString(hello[11 : 11+32])
+		if !strings.Contains(keylog.String(), random) {
+			t.Errorf("%x: keylog doesn't mention client random:\n%s", version, keylog.String())
+		}
+		label := "CLIENT_RANDOM "
+		if version == VersionTLS13 {
+			label = "CLIENT_TRAFFIC_SECRET_0 "
+		}
+		if !strings.Contains(keylog.String(), label+random) {
+			t.Errorf("%x: keylog has no %s line", version, label)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package xmodem generates XMODEM and YMODEM file transfers.
+//
+// Transfers are written to a sender/receiver pair of writers,
+// like the ones from any pcapwriter Conversation,
+// so they can ride over whatever transport a puzzle needs.
+package xmodem
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Control characters
+const (
+	SOH = 0x01
+	STX = 0x02
+	EOT = 0x04
+	ACK = 0x06
+	NAK = 0x15
+	CAN = 0x18
+	SUB = 0x1a
+	CRC = 'C'
+)
+
+// File is a file sent by YMODEM
+type File struct {
+	Name    string
+	Data    []byte
+	ModTime time.Time
+}
+
+// ReadFile returns a File holding the contents of the file called name,
+// which is sent under its base name.
+func ReadFile(name string) (File, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return File{}, err
+	}
+	f := File{Name: filepath.Base(name), Data: data}
+	if fi, err := os.Stat(name); err == nil {
+		f.ModTime = fi.ModTime()
+	}
+	return f, nil
+}
+
+// Session describes how blocks are sent.
+type Session struct {
+	// Use a CRC-16 instead of an 8-bit checksum.
+	// YMODEM always uses CRC-16.
+	CRC bool
+
+	// Send 1024-byte blocks (STX) instead of 128-byte blocks (SOH).
+	// YMODEM always sends 1024-byte blocks.
+	OneK bool
+
+	// Blocks the receiver NAKs the first time,
+	// as if they were damaged in transit.
+	// Block numbers count from 1, over the whole session.
+	Garble []int
+
+	sent int
+}
+
+// crc16 computes the CRC-16/XMODEM of p
+func crc16(p []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range p {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func checksum(p []byte) byte {
+	sum := byte(0)
+	for _, b := range p {
+		sum += b
+	}
+	return sum
+}
+
+// Block returns block n, padded to size with pad,
+// followed by a CRC-16 or a checksum.
+//
+// It returns an error if data doesn't fit in size bytes.
+func Block(n int, data []byte, size int, crc bool, pad byte) ([]byte, error) {
+	if len(data) > size {
+		return nil, fmt.Errorf("block %d: %d bytes won't fit in a %d-byte block", n, len(data), size)
+	}
+	start := byte(SOH)
+	if size == 1024 {
+		start = STX
+	}
+	buf := []byte{start, byte(n), ^byte(n)}
+	body := append(append([]byte{}, data...), bytes.Repeat([]byte{pad}, size-len(data))...)
+	buf = append(buf, body...)
+	if crc {
+		c := crc16(body)
+		return append(buf, byte(c>>8), byte(c)), nil
+	}
+	return append(buf, checksum(body)), nil
+}
+
+// writer writes bytes from each side, stopping at the first error
+type writer struct {
+	sender   io.Writer
+	receiver io.Writer
+	err      error
+}
+
+func (w *writer) send(to io.Writer, p ...byte) {
+	if w.err == nil {
+		_, w.err = to.Write(p)
+	}
+}
+
+func (s *Session) garbled() bool {
+	s.sent += 1
+	for _, n := range s.Garble {
+		if n == s.sent {
+			return true
+		}
+	}
+	return false
+}
+
+// block sends one block, and has the receiver acknowledge it,
+// resending it if it's to be garbled.
+func (s *Session) block(w *writer, n int, data []byte, size int, crc bool, pad byte) {
+	if w.err != nil {
+		return
+	}
+	blk, err := Block(n, data, size, crc, pad)
+	if err != nil {
+		w.err = err
+		return
+	}
+	if s.garbled() {
+		bad := append([]byte{}, blk...)
+		bad[3] ^= 0x20
+		w.send(w.sender, bad...)
+		w.send(w.receiver, NAK)
+	}
+	w.send(w.sender, blk...)
+	w.send(w.receiver, ACK)
+}
+
+// blocks sends data in blocks, starting with block number 1
+func (s *Session) blocks(w *writer, data []byte, size int, crc bool) {
+	for n := 1; len(data) > 0; n++ {
+		chunk := data
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		data = data[len(chunk):]
+		s.block(w, n, chunk, size, crc, SUB)
+	}
+}
+
+// XMODEM writes an XMODEM transfer of data.
+func (s *Session) XMODEM(sender io.Writer, receiver io.Writer, data []byte) error {
+	w := &writer{sender: sender, receiver: receiver}
+	size := 128
+	if s.OneK {
+		size = 1024
+	}
+
+	// The receiver starts things off, saying which kind of check it wants
+	if s.CRC {
+		w.send(receiver, CRC)
+	} else {
+		w.send(receiver, NAK)
+	}
+	s.blocks(w, data, size, s.CRC)
+	w.send(sender, EOT)
+	w.send(receiver, ACK)
+	return w.err
+}
+
+// YMODEM writes a YMODEM batch transfer of files.
+func (s *Session) YMODEM(sender io.Writer, receiver io.Writer, files []File) error {
+	w := &writer{sender: sender, receiver: receiver}
+	for _, f := range files {
+		// Block 0 has the file name, size, and modification time
+		header := []byte(f.Name)
+		header = append(header, 0)
+		info := fmt.Sprintf("%d", len(f.Data))
+		if !f.ModTime.IsZero() {
+			info += fmt.Sprintf(" %o", f.ModTime.Unix())
+		}
+		header = append(header, info...)
+		size := 128
+		if len(header) > 128 {
+			size = 1024
+		}
+		if len(header) > size {
+			return fmt.Errorf("%s: name too long for a YMODEM header block", f.Name)
+		}
+
+		w.send(receiver, CRC)
+		s.block(w, 0, header, size, true, 0)
+		w.send(receiver, CRC)
+		s.blocks(w, f.Data, 1024, true)
+
+		// The receiver NAKs the first EOT, to make sure it's not line noise
+		w.send(sender, EOT)
+		w.send(receiver, NAK)
+		w.send(sender, EOT)
+		w.send(receiver, ACK)
+	}
+
+	// An empty block 0 ends the batch
+	w.send(receiver, CRC)
+	s.block(w, 0, nil, 128, true, 0)
+	return w.err
+}
@@ -0,0 +1,131 @@
+package xmodem
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// message is one write, from the sender or the receiver
+type message struct {
+	sender bool
+	data   []byte
+}
+
+type transcript struct {
+	messages []message
+}
+
+type side struct {
+	t      *transcript
+	sender bool
+}
+
+func (s side) Write(p []byte) (int, error) {
+	s.t.messages = append(s.t.messages, message{s.sender, append([]byte{}, p...)})
+	return len(p), nil
+}
+
+func newTranscript() (*transcript, side, side) {
+	t := new(transcript)
+	return t, side{t, true}, side{t, false}
+}
+
+// received collects the data blocks the receiver accepted
+func (t *transcript) received() [][]byte {
+	var blocks [][]byte
+	for i, m := range t.messages {
+		if !m.sender || (m.data[0] != SOH && m.data[0] != STX) {
+			continue
+		}
+		if i+1 < len(t.messages) && t.messages[i+1].data[0] == ACK {
+			size := 128
+			if m.data[0] == STX {
+				size = 1024
+			}
+			blocks = append(blocks, m.data[3:3+size])
+		}
+	}
+	return blocks
+}
+
+func TestCRC(t *testing.T) {
+	if c := crc16([]byte("123456789")); c != 0x31c3 {
+		t.Errorf("wrong CRC: %04x", c)
+	}
+}
+
+func TestXMODEM(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox. ", 20))
+	for _, s := range []Session{{}, {CRC: true}, {CRC: true, OneK: true}, {Garble: []int{2}}} {
+		tr, sender, receiver := newTranscript()
+		if err := s.XMODEM(sender, receiver, data); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.CRC && tr.messages[0].data[0] != CRC {
+			t.Error("receiver didn't ask for CRC")
+		}
+		got := bytes.TrimRight(bytes.Join(tr.received(), nil), "\x1a")
+		if !bytes.Equal(got, data) {
+			t.Errorf("%+v: wrong data received: %q", s, got)
+		}
+
+		last := tr.messages[len(tr.messages)-2:]
+		if last[0].data[0] != EOT || last[1].data[0] != ACK {
+			t.Errorf("%+v: no EOT", s)
+		}
+
+		naks := 0
+		for _, m := range tr.messages[1:] {
+			if m.data[0] == NAK {
+				naks += 1
+			}
+		}
+		if naks != len(s.Garble) {
+			t.Errorf("%+v: %d NAKs", s, naks)
+		}
+	}
+}
+
+func TestYMODEM(t *testing.T) {
+	files := []File{
+		{Name: "a.txt", Data: []byte("alpha\n")},
+		{Name: "b.bin", Data: bytes.Repeat([]byte{0, 0xff}, 1000)},
+	}
+	tr, sender, receiver := newTranscript()
+	s := new(Session)
+	if err := s.YMODEM(sender, receiver, files); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := tr.received()
+	if len(blocks) != 1+1+1+2+1 {
+		t.Fatal("wrong number of blocks:", len(blocks))
+	}
+	if !bytes.HasPrefix(blocks[0], []byte("a.txt\x006\x00")) {
+		t.Errorf("wrong header: %q", blocks[0][:16])
+	}
+	if !bytes.HasPrefix(blocks[2], []byte("b.bin\x002000\x00")) {
+		t.Errorf("wrong header: %q", blocks[2][:16])
+	}
+	if !bytes.Equal(blocks[5], make([]byte, 128)) {
+		t.Error("batch not ended with an empty header")
+	}
+	got := append(append([]byte{}, blocks[3]...), blocks[4]...)
+	if !bytes.Equal(got[:2000], files[1].Data) {
+		t.Error("wrong data received")
+	}
+}
+
+func TestYMODEMLongName(t *testing.T) {
+	_, sender, receiver := newTranscript()
+	files := []File{{Name: strings.Repeat("x", 1024), Data: []byte("moo")}}
+	if err := new(Session).YMODEM(sender, receiver, files); err == nil {
+		t.Error("no error for a name too long for block 0")
+	}
+
+	if _, err := Block(1, make([]byte, 129), 128, true, SUB); err == nil {
+		t.Error("no error for an oversized block")
+	}
+}